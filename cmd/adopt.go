@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+// adoptCmd represents the adopt command
+var adoptCmd = &cobra.Command{
+	Use:   "adopt [goroot]...",
+	Short: "Register go installations from other version managers as toolchains",
+	Long: `Register go installations from other version managers as toolchains.
+
+Without arguments /usr/local/go, gvm, goenv, asdf and golang.org/dl installs
+in ~/sdk are discovered. Each install is compared with its release archive
+when that archive is cached; mismatching installs are skipped unless --force
+is given. Installs are registered by reference unless --copy is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		byCopy, _ := cmd.Flags().GetBool("copy")
+		force, _ := cmd.Flags().GetBool("force")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		candidates, err := adoptCandidates(args)
+		if err != nil {
+			return err
+		}
+
+		if len(candidates) == 0 {
+			fmt.Println("no go installations found")
+			return nil
+		}
+
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer w.Flush()
+
+		for _, c := range candidates {
+			a, err := m.Check(c)
+			if err != nil {
+				return err
+			}
+
+			status := adoptStatus(a)
+			switch {
+			case len(a.Drift) > 0 && !force:
+				status += ", skipped"
+			case dryRun:
+			default:
+				if _, err = m.Adopt(a, byCopy); errors.Is(err, toolchain.ErrInstalled) {
+					status = "already installed"
+				} else if err != nil {
+					return err
+				} else {
+					status += ", adopted"
+				}
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Version, a.Source, a.GoRoot, status)
+		}
+		return nil
+	},
+}
+
+// adoptCandidates inspects the given GOROOTs, or discovers them
+func adoptCandidates(args []string) ([]*toolchain.Candidate, error) {
+	if len(args) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		return toolchain.Discover(home)
+	}
+
+	var out []*toolchain.Candidate
+	for _, arg := range args {
+		c, err := toolchain.Inspect(arg, "path")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func adoptStatus(a *toolchain.Adoption) string {
+	switch {
+	case a.Verified:
+		return "verified"
+	case len(a.Drift) > 0:
+		return fmt.Sprintf("%d files differ from the release", len(a.Drift))
+	default:
+		return "unverified, archive not cached"
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(adoptCmd)
+	adoptCmd.Flags().Bool("copy", false, "copy installs into the toolchains directory instead of referencing them")
+	adoptCmd.Flags().Bool("force", false, "adopt installs that differ from their release archive")
+	adoptCmd.Flags().Bool("dry-run", false, "only report what would be adopted")
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/bisect"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"github.com/spf13/cobra"
+	"os"
+	"os/exec"
+)
+
+// bisectCmd represents the bisect command
+var bisectCmd = &cobra.Command{
+	Use:   "bisect --good <version> --bad <version> -- <command> [args...]",
+	Short: "Find the first Go release where a command starts failing",
+	Long: `Binary search the catalog releases between --good and --bad, installing
+each candidate and running the command under it. Exit code 0 marks a release
+good, 125 skips it and anything else marks it bad.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		good, _ := cmd.Flags().GetString("good")
+		bad, _ := cmd.Flags().GetString("bad")
+		unstable, _ := cmd.Flags().GetBool("unstable")
+		noVerify, _ := cmd.Flags().GetBool("no-verify")
+
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		all, err := m.Versions(unstable)
+		if err != nil {
+			return err
+		}
+
+		candidates, err := bisect.Range(all, resolver.Normalize(good), resolver.Normalize(bad))
+		if err != nil {
+			return err
+		}
+
+		test := func(version string) (bisect.Verdict, error) {
+			// a release that cannot be installed, such as one without an
+			// archive for this platform, is skipped instead of ending the search
+			t, err := m.Ensure(version)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "bisect: skipping %s: %v\n", version, err)
+				return bisect.Skip, nil
+			}
+
+			c, err := t.Command(cmd.Context(), args[0], args[1:]...)
+			if err != nil {
+				return bisect.Skip, err
+			}
+			c.Stdout = os.Stderr
+			c.Stderr = os.Stderr
+
+			fmt.Fprintf(os.Stderr, "bisect: testing %s\n", version)
+
+			err = c.Run()
+
+			var exitErr *exec.ExitError
+			switch {
+			case err == nil:
+				return bisect.Good, nil
+			case errors.As(err, &exitErr) && exitErr.ExitCode() == bisect.SkipCode:
+				return bisect.Skip, nil
+			case errors.As(err, &exitErr):
+				return bisect.Bad, nil
+			default:
+				return bisect.Skip, err
+			}
+		}
+
+		result, err := bisect.Run(candidates, test, !noVerify)
+		if result != nil {
+			if werr := bisect.WriteLog(os.Stdout, result); werr != nil && err == nil {
+				err = werr
+			}
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bisectCmd)
+
+	bisectCmd.Flags().String("good", "", "release known to pass, e.g. go1.21.0")
+	bisectCmd.Flags().String("bad", "", "release known to fail, e.g. go1.22.3")
+	bisectCmd.Flags().Bool("unstable", false, "include release candidates and betas")
+	bisectCmd.Flags().Bool("no-verify", false, "do not check that --good passes and --bad fails first")
+	_ = bisectCmd.MarkFlagRequired("good")
+	_ = bisectCmd.MarkFlagRequired("bad")
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// currentCmd represents the current command
+var currentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Show the active go version and which file or variable chose it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		sel, err := resolver.Resolve(dir, m.Global)
+		if err != nil {
+			return err
+		}
+
+		version, err := m.Lookup(sel.Version)
+		if err != nil {
+			return err
+		}
+
+		if _, err = m.Get(version); err != nil {
+			if !errors.Is(err, toolchain.ErrNotInstalled) {
+				return err
+			}
+
+			fmt.Printf("%s, not installed\n", sel)
+			return nil
+		}
+
+		fmt.Println(sel)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(currentCmd)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/runner"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+)
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec <version> -- <command> [args...]",
+	Short: "Run a command under a specific toolchain without changing any pin",
+	Long: `Run a command with GOROOT, PATH and GOTOOLCHAIN=local set for a toolchain,
+installing it when missing. The version can be exact (go1.21.0), a release
+line (1.22), latest, latest-N or a constraint such as ">=1.21".`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spec, argv := args[0], args[1:]
+		if argv[0] == "--" {
+			argv = argv[1:]
+		}
+
+		if len(argv) == 0 {
+			return fmt.Errorf("missing command to run")
+		}
+
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		version, err := m.Resolve(spec)
+		if err != nil {
+			return err
+		}
+
+		t, err := m.Ensure(version)
+		if err != nil {
+			return err
+		}
+
+		if dir, err := os.Getwd(); err == nil {
+			if err = m.RecordUsage(t.Version, dir); err != nil {
+				slog.Debug("cannot record toolchain usage", "error", err)
+			}
+		}
+
+		// not bound to the command context, signals are forwarded instead
+		c, err := t.Command(context.Background(), argv[0], argv[1:]...)
+		if err != nil {
+			return err
+		}
+
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+
+		code, err := runner.Run(c)
+		if err != nil {
+			return err
+		}
+
+		if code != 0 {
+			database.CloseConnection()
+			os.Exit(code)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	// everything after the version belongs to the command
+	execCmd.Flags().SetInterspersed(false)
+}
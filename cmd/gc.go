@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Uninstall toolchains unused for a while or beyond a disk budget",
+	Long: `Uninstall toolchains unused for a while or beyond a disk budget.
+
+Toolchains behind an alias such as the global default, or pinned by a project
+that used them, are never removed. Toolchains adopted by reference are only
+unregistered, their tree is left in place.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		days, _ := cmd.Flags().GetInt("unused-days")
+		budget, _ := cmd.Flags().GetString("budget")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		policy := toolchain.GCPolicy{
+			UnusedFor: time.Duration(days) * 24 * time.Hour,
+			DryRun:    dryRun,
+		}
+
+		if budget != "" {
+			size, err := humanize.ParseBytes(budget)
+			if err != nil {
+				return fmt.Errorf("invalid budget: %w", err)
+			}
+			policy.Budget = int64(size)
+		}
+
+		if policy.UnusedFor == 0 && policy.Budget == 0 {
+			return fmt.Errorf("set --unused-days or --budget")
+		}
+
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		removed, err := m.GC(policy)
+
+		verb := "removed"
+		if dryRun {
+			verb = "would remove"
+		}
+
+		var freed uint64
+		for _, u := range removed {
+			freed += uint64(u.Size)
+			fmt.Printf("%s %s, last used %s\n", verb, u.Version, humanize.Time(time.Unix(u.LastUsed, 0)))
+		}
+		fmt.Printf("%d toolchains, %s\n", len(removed), humanize.Bytes(freed))
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().Int("unused-days", 0, "remove toolchains not used for this many days")
+	gcCmd.Flags().String("budget", "", "remove least recently used toolchains until the installed ones fit, e.g. 10GB")
+	gcCmd.Flags().Bool("dry-run", false, "only report what would be removed")
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/spf13/cobra"
+)
+
+// globalCmd represents the global command
+var globalCmd = &cobra.Command{
+	Use:   "global [version]",
+	Short: "Show or set the default go version used outside pinned projects",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		if len(args) == 0 {
+			global, err := m.Global()
+			if err != nil {
+				return err
+			}
+
+			if global == "" {
+				return fmt.Errorf("no global version set")
+			}
+
+			fmt.Println(global)
+			return nil
+		}
+
+		// an alias such as stable makes the default follow that channel
+		version, err := resolver.Validate(args[0])
+		if err != nil {
+			if target, aerr := m.GetAlias(args[0]); aerr != nil || target == "" {
+				return err
+			}
+			version = args[0]
+		}
+
+		if err = m.SetAlias(toolchain.GlobalAlias, version); err != nil {
+			return err
+		}
+
+		fmt.Printf("global version set to %s\n", version)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(globalCmd)
+}
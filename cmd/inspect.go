@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/inspect"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/vuln"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <path>...",
+	Short: "Show how Go binaries were built",
+	Long: `Show how Go binaries were built.
+
+The build info embedded by the go command tells the Go version, the main
+module, every linked module and the build settings, VCS revision included.
+The Go version is placed in the support window of the release catalog and,
+once a vulnerability database was imported with vuln import, the modules
+are checked against it. Directories are searched for Go binaries.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+
+		if err := database.NewDatabase(); err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		catalog, err := mapper.NewMapVersions(cmd.Context(), database.GetConnection(), nil)
+		if err != nil {
+			return err
+		}
+
+		vulns, err := vuln.NewDB(cmd.Context(), database.GetConnection())
+		if err != nil {
+			return err
+		}
+
+		inspector, err := inspect.NewInspector(catalog, vulns)
+		if err != nil {
+			return err
+		}
+
+		reports, err := inspector.InspectAll(args)
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(reports)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tMODULE\tVERSION\tGO\tSUPPORT\tVULNS")
+		for _, r := range reports {
+			if r.Build == nil {
+				fmt.Fprintf(w, "%s\t%s\t\t\t\t\n", r.Path, r.Error)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Path, dash(r.Build.Module), dash(r.Build.Version), r.Build.GoVersion, support(r.Support), vulnCount(r))
+		}
+		if err = w.Flush(); err != nil || !verbose {
+			return err
+		}
+
+		for _, r := range reports {
+			if r.Build != nil {
+				printReport(os.Stdout, r)
+			}
+		}
+		return nil
+	},
+}
+
+// printReport prints the build settings, the modules and the findings of a binary
+func printReport(out io.Writer, r *inspect.Report) {
+	fmt.Fprintf(out, "\n%s\n", r.Path)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  package\t%s\n", r.Build.Path)
+	for _, s := range r.Build.Settings {
+		fmt.Fprintf(w, "  %s\t%s\n", s.Key, s.Value)
+	}
+	w.Flush()
+
+	if len(r.Build.Deps) > 0 {
+		fmt.Fprintln(out, "\n  DEPENDENCY")
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, d := range r.Build.Deps {
+			replace := ""
+			if d.ReplacePath != "" {
+				replace = "=> " + strings.TrimSuffix(d.ReplacePath+" "+d.ReplaceVersion, " ")
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", d.Path, d.Version, d.Sum, replace)
+		}
+		w.Flush()
+	}
+
+	if len(r.Vulns) > 0 {
+		fmt.Fprintln(out, "\n  VULNERABILITY")
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, f := range r.Vulns {
+			fmt.Fprintf(w, "  %s\t%s@%s\tfixed in %s\t%s\n", f.ID, f.Module, f.Version, dash(f.Fixed), strings.Join(f.Symbols, ", "))
+		}
+		w.Flush()
+	}
+}
+
+// support describes where a Go version stands in the support window
+func support(s *mapper.Support) string {
+	switch {
+	case s == nil:
+		return "-"
+	case !s.Supported:
+		return "unsupported"
+	case !s.UpToDate():
+		return "supported, " + s.Latest + " available"
+	default:
+		return "supported"
+	}
+}
+
+func vulnCount(r *inspect.Report) string {
+	if !r.VulnChecked {
+		return "-"
+	}
+	return strconv.Itoa(len(r.Vulns))
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+	inspectCmd.Flags().Bool("json", false, "print the reports as JSON")
+	inspectCmd.Flags().BoolP("verbose", "v", false, "print build settings, dependencies and vulnerabilities")
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// localCmd represents the local command
+var localCmd = &cobra.Command{
+	Use:   "local <version>",
+	Short: "Pin the go version of the current directory in .go-version",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		toolVersions, err := cmd.Flags().GetBool("tool-versions")
+		if err != nil {
+			return err
+		}
+
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		written, err := resolver.WriteLocal(dir, args[0], toolVersions)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range written {
+			fmt.Printf("wrote %s\n", path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(localCmd)
+
+	localCmd.Flags().Bool("tool-versions", false, "also write the golang entry of an asdf .tool-versions file")
+}
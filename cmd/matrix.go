@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/matrix"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// matrixCmd represents the matrix command
+var matrixCmd = &cobra.Command{
+	Use:   "matrix --go <constraint> -- <command> [args...]",
+	Short: "Run a command under every toolchain matching a constraint",
+	Long: `Resolve the catalog releases matching --go, install them and run the
+command under each one in parallel, then print a pass/fail table. By default
+only the newest patch of every release line is used.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		constraint, _ := cmd.Flags().GetString("go")
+		allPatches, _ := cmd.Flags().GetBool("all-patches")
+		unstable, _ := cmd.Flags().GetBool("unstable")
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		jsonFile, _ := cmd.Flags().GetString("json")
+		junitFile, _ := cmd.Flags().GetString("junit")
+
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		versions, err := m.Match(constraint, unstable)
+		if err != nil {
+			return err
+		}
+
+		if !allPatches {
+			versions = matrix.Latest(versions)
+		}
+
+		if len(versions) == 0 {
+			return fmt.Errorf("no release in catalog matches %q", constraint)
+		}
+
+		toolchains := make([]*toolchain.Toolchain, 0, len(versions))
+		for _, v := range versions {
+			t, err := m.Ensure(v)
+			if err != nil {
+				return err
+			}
+			toolchains = append(toolchains, t)
+		}
+
+		results := matrix.Run(cmd.Context(), toolchains, args, parallel)
+
+		for _, r := range results {
+			if !r.Passed {
+				fmt.Printf("--- %s\n%s", r.Version, r.Output)
+				if r.Output == "" {
+					fmt.Println(r.Error)
+				}
+			}
+		}
+
+		if err = matrix.WriteTable(os.Stdout, results); err != nil {
+			return err
+		}
+
+		if jsonFile != "" {
+			if err = writeReport(jsonFile, func(f *os.File) error { return matrix.WriteJSON(f, results) }); err != nil {
+				return err
+			}
+		}
+
+		if junitFile != "" {
+			if err = writeReport(junitFile, func(f *os.File) error { return matrix.WriteJUnit(f, "moonlight.matrix", results) }); err != nil {
+				return err
+			}
+		}
+
+		if matrix.Failed(results) {
+			database.CloseConnection()
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+// writeReport creates path and fills it with write
+func writeReport(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func init() {
+	rootCmd.AddCommand(matrixCmd)
+
+	matrixCmd.Flags().String("go", "", "version constraint selecting the toolchains, e.g. '>=1.21'")
+	matrixCmd.Flags().Bool("all-patches", false, "run every matching patch release instead of the newest per line")
+	matrixCmd.Flags().Bool("unstable", false, "include release candidates and betas")
+	matrixCmd.Flags().IntP("parallel", "p", 2, "maximum number of concurrent runs")
+	matrixCmd.Flags().String("json", "", "write the results as JSON to this file")
+	matrixCmd.Flags().String("junit", "", "write the results as a JUnit report to this file")
+	_ = matrixCmd.MarkFlagRequired("go")
+}
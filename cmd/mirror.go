@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/mirror"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// mirrorCmd represents the mirror command
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Manage the release files kept by the mirror",
+}
+
+var mirrorSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Download the release files selected by mirror.profile",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		if err := database.NewDatabase(); err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		catalog, err := mapper.NewMapVersions(cmd.Context(), database.GetConnection(), nil)
+		if err != nil {
+			return err
+		}
+
+		store, err := artifact.NewStore(config.GetConfig.Paths.CacheDir())
+		if err != nil {
+			return err
+		}
+
+		syncer := mirror.NewSyncer(catalog, store, config.GetConfig.Mirror.Profile)
+
+		var report *mirror.Report
+		if dryRun {
+			report, err = syncer.Status()
+		} else {
+			report, err = syncer.Run()
+		}
+		if report == nil {
+			return err
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if jerr := enc.Encode(report); jerr != nil {
+				return jerr
+			}
+			return err
+		}
+
+		for _, name := range report.Downloaded {
+			fmt.Printf("downloaded %s\n", name)
+		}
+		for _, name := range report.Missing {
+			fmt.Printf("missing    %s\n", name)
+		}
+		fmt.Printf("%d files selected, %d cached, %d downloaded, %d missing\n", report.Matched, report.Cached, len(report.Downloaded), len(report.Missing))
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mirrorCmd)
+	mirrorCmd.AddCommand(mirrorSyncCmd)
+	mirrorSyncCmd.Flags().Bool("dry-run", false, "only report the selected files missing from the cache")
+	mirrorSyncCmd.Flags().Bool("json", false, "print the report as JSON")
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/spf13/cobra"
+)
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [alias]",
+	Short: "Move the global default or a channel alias back to its previous version",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := toolchain.GlobalAlias
+		if len(args) == 1 {
+			name = args[0]
+		}
+
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		version, err := m.Rollback(name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s rolled back to %s\n", name, version)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+}
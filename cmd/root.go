@@ -2,7 +2,11 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"github.com/inovacc/moonlight/internal/component"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/shim"
+	"github.com/spf13/cobra"
 	"log/slog"
 	"os"
 )
@@ -10,13 +14,15 @@ import (
 var rootCmd = &cobra.Command{
 	Use:   "moonlight",
 	Short: "A brief description of your application",
+	// errors are reported once by Execute, without the usage text
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		configFile, _ := cmd.Flags().GetString("config")
+		loadConfig(configFile)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		configFile, err := cmd.Flags().GetString("config")
-		if err != nil {
-			return err
-		}
-
-		return component.Run(configFile)
+		return component.Run(cmd, args)
 	},
 }
 
@@ -24,12 +30,38 @@ func Execute() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// invoked through a go or gofmt shim, dispatch to the selected toolchain
+	if name := shim.Name(os.Args[0]); name != "" {
+		loadConfig("")
+
+		if err := runShim(ctx, name, os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "moonlight: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cobra.CheckErr(rootCmd.ExecuteContext(ctx))
 }
 
+// loadConfig reads the config file, or the one named by CONFIG_FILE, when
+// present, defaults are used otherwise
+func loadConfig(configFile string) {
+	for _, path := range []string{configFile, os.Getenv("CONFIG_FILE")} {
+		if path == "" {
+			continue
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			config.SetConfig(path)
+			return
+		}
+	}
+}
+
 func init() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
 
-	rootCmd.Flags().StringP("config", "c", "config.yaml", "config file (default is config.yaml)")
+	rootCmd.PersistentFlags().StringP("config", "c", "config.yaml", "config file (default is config.yaml)")
 }
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/checksum"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/modproxy"
+	"github.com/inovacc/moonlight/internal/server"
+	"github.com/spf13/cobra"
+	"os/signal"
+	"syscall"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the mirror over HTTP",
+	Long: `Serve the mirror over HTTP.
+
+The catalog is served at /dl/?mode=json in the go.dev format and release
+files at /dl/<filename> from the cache, so the server is a drop-in mirror of
+go.dev/dl. Missing files are fetched from mirror.upstream with --pull-through.
+
+The server root is a GOPROXY caching modules from proxy.upstream, cached
+modules stay available when upstream is down. The golang.org/toolchain module
+is served from the cached release archives, so GOTOOLCHAIN switching
+downloads from the mirror too.
+
+With proxy.sumdb.enabled every module zip and go.mod is checked against the
+checksum database before it is cached, and the database itself is proxied at
+/sumdb/<name>/ for clients that cannot reach it.
+
+Modules under a proxy.repos prefix are built from that git repo instead,
+versions come from its semver tags and pseudo-versions of its commits. They
+are not in the public checksum database, so clients need them in GONOSUMDB
+or GOPRIVATE, e.g. GONOSUMDB=corp.example.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if addr, _ := cmd.Flags().GetString("addr"); addr != "" {
+			config.NewConfig(config.WithServerAddr(addr))
+		}
+
+		pullThrough := config.GetConfig.Mirror.PullThrough
+		if cmd.Flags().Changed("pull-through") {
+			pullThrough, _ = cmd.Flags().GetBool("pull-through")
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		if err := database.NewDatabase(); err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		catalog, err := mapper.NewMapVersions(ctx, database.GetConnection(), nil)
+		if err != nil {
+			return err
+		}
+
+		store, err := artifact.NewStore(config.GetConfig.Paths.CacheDir())
+		if err != nil {
+			return err
+		}
+
+		srv := server.NewServer(config.GetConfig.Server.Addr)
+		srv.Handle(server.ListPattern, server.NewList(catalog))
+		srv.Handle(server.FilesPattern, server.NewFiles(catalog, store, pullThrough))
+		srv.Handle(server.ToolchainPattern, server.NewToolchainModule(catalog, store))
+
+		var verifier modproxy.Verifier
+		if sumdb := config.GetConfig.Proxy.SumDB; sumdb.Enabled {
+			v, err := checksum.NewVerifier(ctx, database.GetConnection(), store, sumdb)
+			if err != nil {
+				return err
+			}
+			verifier = v
+			srv.Handle(modproxy.SumDBPattern, modproxy.NewSumDBProxy(sumdb.Name, sumdb.URL))
+		}
+
+		proxy := modproxy.NewProxy(store, config.GetConfig.Proxy.Upstream, verifier)
+		for _, repo := range config.GetConfig.Proxy.Repos {
+			r, err := modproxy.NewGitRepo(store, repo.Prefix, repo.URL)
+			if err != nil {
+				return err
+			}
+			proxy.AddRepo(r)
+		}
+		srv.Handle(modproxy.Pattern, proxy)
+
+		return srv.Run(ctx)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String("addr", "", "address to listen on, overrides server.addr")
+	serveCmd.Flags().Bool("pull-through", false, "download files missing from the cache from upstream, overrides mirror.pullThrough")
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/shim"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+// shimsCmd represents the shims command
+var shimsCmd = &cobra.Command{
+	Use:   "shims",
+	Short: "Generate the go and gofmt shims in the moonlight bin directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+
+		if exe, err = filepath.EvalSymlinks(exe); err != nil {
+			return err
+		}
+
+		binDir := config.GetConfig.Paths.BinDir()
+		if err = shim.Generate(binDir, exe); err != nil {
+			return err
+		}
+
+		fmt.Printf("shims written to %s, add it to the front of PATH\n", binDir)
+		return nil
+	},
+}
+
+// runShim dispatches a shim invocation to the selected toolchain
+func runShim(ctx context.Context, name string, args []string) error {
+	m, err := newToolchainManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer database.CloseConnection()
+
+	return shim.Run(m, name, args)
+}
+
+func init() {
+	rootCmd.AddCommand(shimsCmd)
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// toolchainsCmd represents the toolchains command
+var toolchainsCmd = &cobra.Command{
+	Use:   "toolchains",
+	Short: "Manage installed Go toolchains",
+}
+
+var toolchainsInstallCmd = &cobra.Command{
+	Use:   "install <version>...",
+	Short: "Install toolchains from the catalog",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		for _, arg := range args {
+			t, err := m.Install(resolver.Normalize(arg))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s installed in %s\n", t.Version, t.GoRoot)
+		}
+		return nil
+	},
+}
+
+var toolchainsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List installed toolchains",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		list, err := m.List()
+		if err != nil {
+			return err
+		}
+
+		global, err := m.Global()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, t := range list {
+			mark := " "
+			if t.Version == global {
+				mark = "*"
+			}
+			fmt.Fprintf(w, "%s %s\t%s\n", mark, t.Version, t.GoRoot)
+		}
+		return w.Flush()
+	},
+}
+
+var toolchainsUninstallCmd = &cobra.Command{
+	Use:   "uninstall <version>...",
+	Short: "Remove installed toolchains",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		for _, arg := range args {
+			if err = m.Uninstall(resolver.Normalize(arg)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var toolchainsUsageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show when installed toolchains were last used and their disk space",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		list, err := m.Usage()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tLAST USED\tINVOCATIONS\tPROJECTS\tSIZE\tPINNED BY")
+		for _, u := range list {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", u.Version, humanize.Time(time.Unix(u.LastUsed, 0)), u.Invocations, u.Projects, humanize.Bytes(uint64(u.Size)), u.Pinned)
+		}
+		return w.Flush()
+	},
+}
+
+// newToolchainManager opens the database, the catalog and the toolchain manager,
+// callers must close the database connection
+func newToolchainManager(ctx context.Context) (*toolchain.Manager, error) {
+	if err := database.NewDatabase(); err != nil {
+		return nil, err
+	}
+
+	catalog, err := mapper.NewMapVersions(ctx, database.GetConnection(), nil)
+	if err != nil {
+		database.CloseConnection()
+		return nil, err
+	}
+
+	store, err := artifact.NewStore(config.GetConfig.Paths.CacheDir())
+	if err != nil {
+		database.CloseConnection()
+		return nil, err
+	}
+
+	m, err := toolchain.NewManager(ctx, database.GetConnection(), catalog, store, config.GetConfig.Paths.ToolchainsDir())
+	if err != nil {
+		database.CloseConnection()
+		return nil, err
+	}
+	return m, nil
+}
+
+func init() {
+	rootCmd.AddCommand(toolchainsCmd)
+	toolchainsCmd.AddCommand(toolchainsInstallCmd)
+	toolchainsCmd.AddCommand(toolchainsListCmd)
+	toolchainsCmd.AddCommand(toolchainsUninstallCmd)
+	toolchainsCmd.AddCommand(toolchainsUsageCmd)
+}
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/installer"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// toolsCmd represents the tools command
+var toolsCmd = &cobra.Command{
+	Use:   "tools",
+	Short: "Manage Go tools installed with go install",
+}
+
+var toolsSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Install, update or remove tools to match the tool manifest",
+	Long: `Install, update or remove tools to match the tool manifest.
+
+The manifest lists the desired tools:
+
+  tools:
+    - package: golang.org/x/tools/gopls
+    - package: honnef.co/go/tools/cmd/staticcheck
+      version: ^0.4
+    - package: github.com/gomods/athens/cmd/proxy
+      binaryName: athens
+      buildFlags: [-trimpath, "-ldflags=-s -w"]
+      env: [CGO_ENABLED=0]
+      go: 1.22.5
+
+Tools installed by moonlight but missing from the manifest are removed. With
+--plan the changes are only printed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, _ := cmd.Flags().GetString("file")
+		planOnly, _ := cmd.Flags().GetBool("plan")
+
+		manifest, err := installer.LoadManifest(file)
+		if err != nil {
+			return err
+		}
+
+		i, err := newInstaller(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		changes, err := i.Plan(manifest)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ACTION\tTOOL\tFROM\tTO")
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Action, c.Binary, dash(c.From), dash(c.To))
+		}
+		if err = w.Flush(); err != nil || planOnly {
+			return err
+		}
+		return i.Sync(changes)
+	},
+}
+
+var toolsOutdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "List installed tools with a newer version",
+	Long: `List installed tools with a newer version.
+
+ALLOWED is the newest version the constraint the tool was installed with
+accepts, LATEST the newest version of its module. With --upgrade the tools
+are moved to their allowed version.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		upgrade, _ := cmd.Flags().GetBool("upgrade")
+
+		i, err := newInstaller(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		outdated, checkErr := i.Outdated()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TOOL\tCURRENT\tALLOWED\tLATEST\tCONSTRAINT")
+		for _, o := range outdated {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", o.Binary, o.Current, o.Allowed, o.Latest, o.Constraint)
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+
+		if !upgrade {
+			return checkErr
+		}
+
+		upgraded, err := i.Upgrade(outdated)
+		for _, o := range upgraded {
+			fmt.Printf("%s upgraded from %s to %s\n", o.Binary, o.Current, o.Allowed)
+		}
+		return errors.Join(checkErr, err)
+	},
+}
+
+var toolsUseCmd = &cobra.Command{
+	Use:   "use <tool>@<version>",
+	Short: "Point a tool at one of its installed versions",
+	Long: `Point a tool at one of its installed versions.
+
+Every tool version is installed into its own directory below the moonlight
+home, the tool in the bin directory links to the version in use. The
+previous version is recorded for rollback.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tool, version, ok := strings.Cut(args[0], "@")
+		if !ok || tool == "" || version == "" {
+			return fmt.Errorf("%q is not <tool>@<version>", args[0])
+		}
+
+		i, err := newInstaller(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		if err = i.Use(tool, version); err != nil {
+			return err
+		}
+
+		active, err := i.Active(tool)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s now uses %s\n", tool, active)
+		return nil
+	},
+}
+
+var toolsRollbackCmd = &cobra.Command{
+	Use:   "rollback <tool>",
+	Short: "Point a tool back at the version used before",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		i, err := newInstaller(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		version, err := i.Rollback(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s rolled back to %s\n", args[0], version)
+		return nil
+	},
+}
+
+var toolsSbomCmd = &cobra.Command{
+	Use:   "sbom [tool]",
+	Short: "Generate SBOMs of the installed tools",
+	Long: `Generate SBOMs of the installed tools.
+
+The documents are built from the build info recorded from each binary: the
+main module, every linked module with its version and go.sum hash, the
+build settings and the Go toolchain. The SBOM of a single tool is printed,
+without a tool one document per tool is written to --output.
+
+Set tools.sbom in the configuration to store both formats in the artifact
+store at every install.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		i, err := newInstaller(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		installs, err := i.Current()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			installs = slices.DeleteFunc(installs, func(in *installer.Install) bool {
+				return in.Binary() != args[0]
+			})
+
+			if len(installs) == 0 {
+				return fmt.Errorf("%s: %w", args[0], installer.ErrNotInstalled)
+			}
+		}
+
+		if len(args) == 1 && output == "" {
+			data, err := i.SBOM(installs[0], format)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(os.Stdout, string(data))
+			return err
+		}
+
+		if output == "" {
+			output = "."
+		}
+
+		if err = os.MkdirAll(output, 0o755); err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, in := range installs {
+			data, err := i.SBOM(in, format)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			path := filepath.Join(output, strings.ReplaceAll(installer.SBOMName(in, format), "/", "@"))
+			if err = os.WriteFile(path, data, 0o644); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Println(path)
+		}
+		return errors.Join(errs...)
+	},
+}
+
+// newInstaller opens the database and the installer, callers must close the
+// database connection
+func newInstaller(ctx context.Context) (*installer.Installer, error) {
+	if err := database.NewDatabase(); err != nil {
+		return nil, err
+	}
+
+	i, err := installer.NewInstaller(ctx, database.GetConnection())
+	if err != nil {
+		database.CloseConnection()
+		return nil, err
+	}
+	return i, nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(toolsCmd)
+	toolsCmd.AddCommand(toolsSyncCmd)
+	toolsCmd.AddCommand(toolsOutdatedCmd)
+	toolsCmd.AddCommand(toolsUseCmd)
+	toolsCmd.AddCommand(toolsRollbackCmd)
+	toolsCmd.AddCommand(toolsSbomCmd)
+	toolsSyncCmd.Flags().StringP("file", "f", installer.DefaultManifest, "tool manifest")
+	toolsSyncCmd.Flags().Bool("plan", false, "only print the changes")
+	toolsOutdatedCmd.Flags().Bool("upgrade", false, "upgrade outdated tools within their constraint")
+	toolsSbomCmd.Flags().String("format", installer.FormatCycloneDX, "sbom format, cyclonedx or spdx")
+	toolsSbomCmd.Flags().StringP("output", "o", "", "directory the documents are written to")
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify [version]",
+	Short: "Check installed toolchains against the manifest recorded at install",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repair, _ := cmd.Flags().GetBool("repair")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		var reports []*toolchain.Report
+		if len(args) == 0 {
+			reports, err = m.Scrub(repair)
+		} else {
+			reports, err = verifyOne(m, resolver.Normalize(args[0]), repair)
+		}
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err = enc.Encode(reports); err != nil {
+				return err
+			}
+		} else {
+			writeReports(reports)
+		}
+
+		for _, r := range reports {
+			if !r.OK() && !r.Repaired {
+				return fmt.Errorf("toolchains differ from their manifest, run verify --repair")
+			}
+		}
+		return nil
+	},
+}
+
+func verifyOne(m *toolchain.Manager, version string, repair bool) ([]*toolchain.Report, error) {
+	report, err := m.Verify(version)
+	if err != nil {
+		return nil, err
+	}
+
+	if !report.OK() && repair {
+		if err = m.Repair(version); err != nil {
+			return nil, err
+		}
+		report.Repaired = true
+	}
+	return []*toolchain.Report{report}, nil
+}
+
+func writeReports(reports []*toolchain.Report) {
+	for _, r := range reports {
+		switch {
+		case r.OK():
+			fmt.Printf("%s ok\n", r.Version)
+			continue
+		case r.Repaired:
+			fmt.Printf("%s repaired, %d files had drifted\n", r.Version, len(r.Drift))
+		default:
+			fmt.Printf("%s drifted, %d files\n", r.Version, len(r.Drift))
+		}
+
+		for _, d := range r.Drift {
+			fmt.Printf("  %-8s %s\n", d.Kind, d.Path)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().Bool("repair", false, "re-extract drifted toolchains from their verified archive")
+	verifyCmd.Flags().Bool("json", false, "print the reports as JSON")
+}
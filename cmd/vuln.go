@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/installer"
+	"github.com/inovacc/moonlight/internal/vuln"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+// vulnCmd represents the vuln command
+var vulnCmd = &cobra.Command{
+	Use:   "vuln",
+	Short: "Scan installed tools and toolchains against a local vulnerability database",
+	Long: `Scan installed tools and toolchains against a local vulnerability database.
+
+The database is an OSV export of the Go vulnerability database, such as a
+copy of vuln.go.dev, imported from a directory or a zip. Nothing is fetched
+from the network.`,
+}
+
+var vulnImportCmd = &cobra.Command{
+	Use:   "import <dir|zip>",
+	Short: "Import an OSV vulnerability database",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := newVulnDB(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		updated, err := db.Import(args[0])
+		if err != nil {
+			return err
+		}
+
+		total, err := db.Count()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d entries added or updated, %d in the database\n", updated, total)
+		return nil
+	},
+}
+
+var vulnScanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Scan every installed tool binary and toolchain",
+	Long: `Scan every installed tool binary and toolchain.
+
+Tools are matched through the modules and the Go version recorded from
+their binaries, toolchains through the stdlib and the go command. Findings
+that appeared or went away since the previous scan are recorded as events.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		m, err := newToolchainManager(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		i, err := installer.NewInstaller(cmd.Context(), database.GetConnection())
+		if err != nil {
+			return err
+		}
+
+		db, err := vuln.NewDB(cmd.Context(), database.GetConnection())
+		if err != nil {
+			return err
+		}
+
+		findings, _, err := db.Scan(i, m)
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(findings)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TARGET\tKIND\tMODULE\tVERSION\tID\tFIXED")
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Target, f.Kind, f.Module, f.Version, f.ID, dash(f.Fixed))
+		}
+		return w.Flush()
+	},
+}
+
+var vulnEventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "List findings that appeared or went away, newest first",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		db, err := newVulnDB(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer database.CloseConnection()
+
+		events, err := db.Events(limit)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tEVENT\tTARGET\tMODULE\tVERSION\tID\tFIXED")
+		for _, e := range events {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.CreatedAt, e.Event, e.Target, e.Module, e.Version, e.VulnID, dash(e.Fixed))
+		}
+		return w.Flush()
+	},
+}
+
+// newVulnDB opens the database and the vulnerability database, callers must
+// close the database connection
+func newVulnDB(ctx context.Context) (*vuln.DB, error) {
+	if err := database.NewDatabase(); err != nil {
+		return nil, err
+	}
+
+	db, err := vuln.NewDB(ctx, database.GetConnection())
+	if err != nil {
+		database.CloseConnection()
+		return nil, err
+	}
+	return db, nil
+}
+
+func init() {
+	rootCmd.AddCommand(vulnCmd)
+	vulnCmd.AddCommand(vulnImportCmd)
+	vulnCmd.AddCommand(vulnScanCmd)
+	vulnCmd.AddCommand(vulnEventsCmd)
+	vulnScanCmd.Flags().Bool("json", false, "print the findings as JSON")
+	vulnEventsCmd.Flags().Int("limit", 50, "number of events to list")
+}
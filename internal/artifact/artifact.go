@@ -0,0 +1,126 @@
+package artifact
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Namespaces used inside the store
+const (
+	Downloads  = "dl"
+	Toolchains = "toolchain"
+	Modules    = "mod"
+	SumDB      = "sumdb"
+	Repos      = "vcs"
+	SBOM       = "sbom"
+)
+
+var ErrInvalidName = errors.New("invalid artifact name")
+
+// Store is a local file cache split by namespace, writes are atomic
+type Store struct {
+	root string
+}
+
+// Writer is a pending artifact, it becomes visible only after Commit
+type Writer struct {
+	*os.File
+	path string
+}
+
+func NewStore(root string) (*Store, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		root: root,
+	}, nil
+}
+
+// Dir returns the directory of a namespace, creating it if needed
+func (s *Store) Dir(namespace string) (string, error) {
+	dir := filepath.Join(s.root, namespace)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Path returns the location of an artifact, it may not exist yet
+func (s *Store) Path(namespace, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+	return filepath.Join(s.root, namespace, clean), nil
+}
+
+// Has reports whether the artifact exists
+func (s *Store) Has(namespace, name string) bool {
+	path, err := s.Path(namespace, name)
+	if err != nil {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Open opens an artifact for reading
+func (s *Store) Open(namespace, name string) (*os.File, error) {
+	path, err := s.Path(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Create returns a writer for an artifact, the previous content is kept until Commit
+func (s *Store) Create(namespace, name string) (*Writer, error) {
+	path, err := s.Path(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		File: f,
+		path: path,
+	}, nil
+}
+
+// Remove deletes an artifact
+func (s *Store) Remove(namespace, name string) error {
+	path, err := s.Path(namespace, name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Commit closes the writer and moves the artifact into place
+func (w *Writer) Commit() error {
+	if err := w.File.Close(); err != nil {
+		_ = os.Remove(w.File.Name())
+		return err
+	}
+	return os.Rename(w.File.Name(), w.path)
+}
+
+// Abort discards the pending artifact
+func (w *Writer) Abort() {
+	_ = w.File.Close()
+	_ = os.Remove(w.File.Name())
+}
@@ -0,0 +1,51 @@
+package artifact
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := s.Create(Downloads, "go1.22.4.linux-amd64.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.Write([]byte("archive")); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, s.Has(Downloads, "go1.22.4.linux-amd64.tar.gz"))
+
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, s.Has(Downloads, "go1.22.4.linux-amd64.tar.gz"))
+
+	f, err := s.Open(Downloads, "go1.22.4.linux-amd64.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "archive", string(data))
+
+	w, err = s.Create(Downloads, "aborted.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Abort()
+	assert.False(t, s.Has(Downloads, "aborted.zip"))
+
+	_, err = s.Path(Downloads, "../../etc/passwd")
+	assert.ErrorIs(t, err, ErrInvalidName)
+}
@@ -0,0 +1,184 @@
+package bisect
+
+import (
+	"fmt"
+	goversion "go/version"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SkipCode is the exit code a test uses to mark a version as untestable, as in git bisect
+const SkipCode = 125
+
+type Verdict int
+
+const (
+	Good Verdict = iota
+	Bad
+	Skip
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Good:
+		return "good"
+	case Bad:
+		return "bad"
+	default:
+		return "skip"
+	}
+}
+
+// Step is one tested version
+type Step struct {
+	Version  string        `json:"version"`
+	Verdict  Verdict       `json:"verdict"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Result is the first bad release and how it was found
+type Result struct {
+	FirstBad string   `json:"first_bad"`
+	LastGood string   `json:"last_good"`
+	Skipped  []string `json:"skipped,omitempty"`
+	Log      []Step   `json:"log"`
+}
+
+// Test runs the check against a version
+type Test func(version string) (Verdict, error)
+
+// Range returns the releases from good to bad inclusive, oldest first,
+// versions may come in any order
+func Range(versions []string, good, bad string) ([]string, error) {
+	if goversion.Compare(good, bad) >= 0 {
+		return nil, fmt.Errorf("good version %s must be older than bad version %s", good, bad)
+	}
+
+	var foundGood, foundBad bool
+	var out []string
+	for _, v := range versions {
+		if goversion.Compare(v, good) < 0 || goversion.Compare(v, bad) > 0 {
+			continue
+		}
+		foundGood = foundGood || v == good
+		foundBad = foundBad || v == bad
+		out = append(out, v)
+	}
+
+	if !foundGood {
+		return nil, fmt.Errorf("%s not found in catalog", good)
+	}
+	if !foundBad {
+		return nil, fmt.Errorf("%s not found in catalog", bad)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return goversion.Compare(out[i], out[j]) < 0
+	})
+	return out, nil
+}
+
+// Run binary searches versions, oldest first, for the first bad one. The
+// first version must be good and the last one bad, both are checked first
+// when verify is set. On error the result holds the steps tested so far
+func Run(versions []string, test Test, verify bool) (*Result, error) {
+	if len(versions) < 2 {
+		return nil, fmt.Errorf("need at least a good and a bad version")
+	}
+
+	r := &Result{}
+	check := func(v string) (Verdict, error) {
+		start := time.Now()
+		verdict, err := test(v)
+		if err != nil {
+			return verdict, err
+		}
+		r.Log = append(r.Log, Step{Version: v, Verdict: verdict, Duration: time.Since(start)})
+		return verdict, nil
+	}
+
+	good, bad := 0, len(versions)-1
+	if verify {
+		if verdict, err := check(versions[good]); err != nil {
+			return r, err
+		} else if verdict != Good {
+			return r, fmt.Errorf("%s was given as good but tested %s", versions[good], verdict)
+		}
+
+		if verdict, err := check(versions[bad]); err != nil {
+			return r, err
+		} else if verdict != Bad {
+			return r, fmt.Errorf("%s was given as bad but tested %s", versions[bad], verdict)
+		}
+	}
+
+	skipped := make(map[int]bool)
+	for {
+		mid := pick(good, bad, skipped)
+		if mid < 0 {
+			break
+		}
+
+		verdict, err := check(versions[mid])
+		if err != nil {
+			return r, err
+		}
+
+		switch verdict {
+		case Good:
+			good = mid
+		case Bad:
+			bad = mid
+		default:
+			skipped[mid] = true
+		}
+	}
+
+	r.FirstBad = versions[bad]
+	r.LastGood = versions[good]
+	for i := good + 1; i < bad; i++ {
+		r.Skipped = append(r.Skipped, versions[i])
+	}
+	return r, nil
+}
+
+// pick returns the untested index closest to the middle of (good, bad), or -1
+func pick(good, bad int, skipped map[int]bool) int {
+	mid := (good + bad) / 2
+	for d := 0; d < bad-good; d++ {
+		for _, i := range []int{mid - d, mid + d} {
+			if i > good && i < bad && !skipped[i] {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// WriteLog prints the tested versions and the outcome
+func WriteLog(w io.Writer, r *Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tVERSION\tVERDICT\tDURATION")
+	for i, s := range r.Log {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, s.Version, s.Verdict, s.Duration.Round(time.Millisecond))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if r.FirstBad == "" {
+		return nil
+	}
+
+	if len(r.Skipped) > 0 {
+		_, err := fmt.Fprintf(w, "\nfirst bad release is %s or one of the skipped releases %s (last good %s)\n", r.FirstBad, strings.Join(r.Skipped, ", "), r.LastGood)
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\nfirst bad release is %s (last good %s)\n", r.FirstBad, r.LastGood)
+	return err
+}
@@ -0,0 +1,112 @@
+package bisect
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	goversion "go/version"
+	"testing"
+)
+
+var catalog = []string{"go1.22.3", "go1.22.2", "go1.22.1", "go1.22.0", "go1.22rc1", "go1.21.5", "go1.21.4", "go1.21.3", "go1.21.2", "go1.21.1", "go1.21.0", "go1.20.14"}
+
+func TestRange(t *testing.T) {
+	versions, err := Range(catalog, "go1.21.3", "go1.22.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"go1.21.3", "go1.21.4", "go1.21.5", "go1.22rc1", "go1.22.0", "go1.22.1"}, versions)
+
+	_, err = Range(catalog, "go1.22.1", "go1.21.3")
+	assert.Error(t, err)
+
+	_, err = Range(catalog, "go1.19.0", "go1.21.3")
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	versions, err := Range(catalog, "go1.21.0", "go1.22.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tested := map[string]int{}
+	test := func(v string) (Verdict, error) {
+		tested[v]++
+		if goversion.Compare(v, "go1.21.4") >= 0 {
+			return Bad, nil
+		}
+		return Good, nil
+	}
+
+	r, err := Run(versions, test, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.21.4", r.FirstBad)
+	assert.Equal(t, "go1.21.3", r.LastGood)
+	assert.Empty(t, r.Skipped)
+	assert.LessOrEqual(t, len(r.Log), 2+4)
+
+	for v, n := range tested {
+		assert.Equal(t, 1, n, v)
+	}
+
+	var out bytes.Buffer
+	if err = WriteLog(&out, r); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, out.String(), "first bad release is go1.21.4 (last good go1.21.3)")
+}
+
+func TestRunSkip(t *testing.T) {
+	versions := []string{"go1.21.0", "go1.21.1", "go1.21.2", "go1.21.3"}
+
+	test := func(v string) (Verdict, error) {
+		switch v {
+		case "go1.21.0":
+			return Good, nil
+		case "go1.21.1", "go1.21.2":
+			return Skip, nil
+		default:
+			return Bad, nil
+		}
+	}
+
+	r, err := Run(versions, test, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.21.3", r.FirstBad)
+	assert.Equal(t, []string{"go1.21.1", "go1.21.2"}, r.Skipped)
+}
+
+func TestRunVerify(t *testing.T) {
+	versions := []string{"go1.21.0", "go1.21.1"}
+
+	_, err := Run(versions, func(string) (Verdict, error) { return Bad, nil }, true)
+	assert.Error(t, err)
+}
+
+func TestRunError(t *testing.T) {
+	versions := []string{"go1.21.0", "go1.21.1", "go1.21.2", "go1.21.3"}
+
+	test := func(v string) (Verdict, error) {
+		switch v {
+		case "go1.21.0":
+			return Good, nil
+		case "go1.21.3":
+			return Bad, nil
+		default:
+			return Skip, errors.New("broken")
+		}
+	}
+
+	// the steps tested before the error are kept
+	r, err := Run(versions, test, true)
+	assert.Error(t, err)
+	if assert.NotNil(t, r) {
+		assert.Len(t, r.Log, 2)
+		assert.Empty(t, r.FirstBad)
+	}
+}
@@ -0,0 +1,253 @@
+package checksum
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	createTableSum = `CREATE TABLE IF NOT EXISTS module_sum (
+    path TEXT NOT NULL,
+    version TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (path, version)
+)`
+
+	createTableConfig = `CREATE TABLE IF NOT EXISTS sumdb_config (
+    file TEXT PRIMARY KEY,
+    value BLOB NOT NULL
+)`
+
+	insertSumQuery    = `INSERT INTO module_sum (path, version, hash) VALUES (?, ?, ?) ON CONFLICT(path, version) DO NOTHING`
+	selectSumQuery    = `SELECT hash FROM module_sum WHERE path = ? AND version = ?`
+	selectSumsQuery   = `SELECT path, version, hash FROM module_sum WHERE path = ? ORDER BY version`
+	selectConfigQuery = `SELECT value FROM sumdb_config WHERE file = ?`
+	insertConfigQuery = `INSERT INTO sumdb_config (file, value) VALUES (?, ?)`
+	updateConfigQuery = `UPDATE sumdb_config SET value = ? WHERE file = ? AND value = ?`
+)
+
+const (
+	// goModSuffix marks the go.sum line of a go.mod file
+	goModSuffix = "/go.mod"
+
+	remoteTimeout = time.Minute
+)
+
+var ErrMismatch = errors.New("checksum mismatch")
+
+// Sum is a verified go.sum line
+type Sum struct {
+	Path    string `json:"path" db:"path"`
+	Version string `json:"version" db:"version"`
+	Hash    string `json:"hash" db:"hash"`
+}
+
+// Verifier checks module files against a checksum database, using its signed
+// tree head and inclusion proofs, and records the verified go.sum lines
+type Verifier struct {
+	db     *sqlx.DB
+	ctx    context.Context
+	client *sumdb.Client
+}
+
+func NewVerifier(ctx context.Context, db *sqlx.DB, store *artifact.Store, cfg config.SumDB) (*Verifier, error) {
+	v := &Verifier{
+		db:  db,
+		ctx: ctx,
+	}
+
+	if _, err := v.db.ExecContext(ctx, createTableSum); err != nil {
+		return nil, err
+	}
+
+	if _, err := v.db.ExecContext(ctx, createTableConfig); err != nil {
+		return nil, err
+	}
+
+	v.client = sumdb.NewClient(&clientOps{
+		db:    db,
+		ctx:   ctx,
+		store: store,
+		cfg:   cfg,
+		http:  &http.Client{Timeout: remoteTimeout},
+	})
+	v.client.SetGONOSUMDB(cfg.Private)
+	return v, nil
+}
+
+// VerifyMod checks the go.mod of a module version
+func (v *Verifier) VerifyMod(path, version string, data []byte) error {
+	hash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		return err
+	}
+	return v.verify(path, version+goModSuffix, hash)
+}
+
+// VerifyZip checks the zip of a module version
+func (v *Verifier) VerifyZip(path, version, zipFile string) error {
+	hash, err := dirhash.HashZip(zipFile, dirhash.Hash1)
+	if err != nil {
+		return err
+	}
+	return v.verify(path, version, hash)
+}
+
+// Sums returns the verified go.sum lines of a module
+func (v *Verifier) Sums(path string) ([]*Sum, error) {
+	var sums []*Sum
+	if err := v.db.SelectContext(v.ctx, &sums, selectSumsQuery, path); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// String returns the go.sum line
+func (s *Sum) String() string {
+	return fmt.Sprintf("%s %s %s", s.Path, s.Version, s.Hash)
+}
+
+// verify compares a hash with the recorded line, asking the checksum
+// database the first time
+func (v *Verifier) verify(path, version, hash string) error {
+	var known string
+	err := v.db.GetContext(v.ctx, &known, selectSumQuery, path, version)
+	switch {
+	case err == nil:
+		return compare(path, version, known, hash)
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	lines, err := v.client.Lookup(path, version)
+	if errors.Is(err, sumdb.ErrGONOSUMDB) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checksum database lookup %s@%s: %w", path, version, err)
+	}
+
+	prefix := path + " " + version + " "
+	for _, line := range lines {
+		if want, ok := strings.CutPrefix(line, prefix); ok {
+			if err = compare(path, version, want, hash); err != nil {
+				return err
+			}
+			_, err = v.db.ExecContext(v.ctx, insertSumQuery, path, version, hash)
+			return err
+		}
+	}
+	return fmt.Errorf("checksum database has no line for %s %s", path, version)
+}
+
+func compare(path, version, want, got string) error {
+	if want == got {
+		return nil
+	}
+
+	slog.Error("SECURITY ERROR: module checksum mismatch", "module", path, "version", version, "want", want, "got", got)
+	return fmt.Errorf("%s %s: %w, checksum database has %s, upstream served %s", path, version, ErrMismatch, want, got)
+}
+
+// clientOps keeps the checksum database state in the database and its
+// tiles in the artifact store
+type clientOps struct {
+	db    *sqlx.DB
+	ctx   context.Context
+	store *artifact.Store
+	cfg   config.SumDB
+	http  *http.Client
+}
+
+func (o *clientOps) ReadRemote(path string) ([]byte, error) {
+	resp, err := o.http.Get(strings.TrimSuffix(o.cfg.URL, "/") + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (o *clientOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.cfg.Key), nil
+	}
+
+	var value []byte
+	if err := o.db.GetContext(o.ctx, &value, selectConfigQuery, file); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+func (o *clientOps) WriteConfig(file string, old, new []byte) error {
+	if len(old) == 0 {
+		if _, err := o.db.ExecContext(o.ctx, insertConfigQuery, file, new); err != nil {
+			return sumdb.ErrWriteConflict
+		}
+		return nil
+	}
+
+	res, err := o.db.ExecContext(o.ctx, updateConfigQuery, new, file, old)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return sumdb.ErrWriteConflict
+	}
+	return nil
+}
+
+func (o *clientOps) ReadCache(file string) ([]byte, error) {
+	f, err := o.store.Open(artifact.SumDB, file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (o *clientOps) WriteCache(file string, data []byte) {
+	w, err := o.store.Create(artifact.SumDB, file)
+	if err != nil {
+		return
+	}
+
+	if _, err = w.Write(data); err != nil {
+		w.Abort()
+		return
+	}
+	_ = w.Commit()
+}
+
+func (o *clientOps) Log(msg string) {
+	slog.Debug(msg)
+}
+
+func (o *clientOps) SecurityError(msg string) {
+	slog.Error("SECURITY ERROR: checksum database misbehaving", "msg", msg)
+}
@@ -0,0 +1,136 @@
+package checksum
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/database/databasetest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+	modzip "golang.org/x/mod/zip"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	testModule  = "example.com/hello"
+	testVersion = "v1.0.0"
+	testGoMod   = "module example.com/hello\n\ngo 1.21\n"
+	testName    = "localhost.localdev/sumdb"
+)
+
+func TestVerifier(t *testing.T) {
+	zipFile := writeZip(t, "package hello\n")
+
+	zipHash, err := dirhash.HashZip(zipFile, dirhash.Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader([]byte(testGoMod))), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, lookups := newVerifier(t, []byte(testModule+" "+testVersion+" "+zipHash+"\n"+
+		testModule+" "+testVersion+"/go.mod "+modHash+"\n"))
+
+	assert.NoError(t, v.VerifyZip(testModule, testVersion, zipFile))
+	assert.NoError(t, v.VerifyMod(testModule, testVersion, []byte(testGoMod)))
+
+	sums, err := v.Sums(testModule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, sums, 2)
+	assert.Equal(t, testModule+" "+testVersion+" "+zipHash, sums[0].String())
+
+	// recorded lines are checked without asking the database again
+	before := lookups.Load()
+	assert.NoError(t, v.VerifyZip(testModule, testVersion, zipFile))
+	assert.Equal(t, before, lookups.Load())
+
+	tampered := writeZip(t, "package hello\n\nfunc Backdoor() {}\n")
+	err = v.VerifyZip(testModule, testVersion, tampered)
+	assert.True(t, errors.Is(err, ErrMismatch), err)
+
+	err = v.VerifyMod(testModule, testVersion, []byte(testGoMod+"require evil.example v1.0.0\n"))
+	assert.True(t, errors.Is(err, ErrMismatch), err)
+
+	// a version unknown to the database is refused
+	assert.Error(t, v.VerifyZip(testModule, "v2.0.0", zipFile))
+}
+
+// newVerifier serves a test checksum database holding lines and counts its lookups
+func newVerifier(t *testing.T, lines []byte) (*Verifier, *atomic.Int64) {
+	t.Helper()
+
+	databasetest.Open(t)
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lookups := &atomic.Int64{}
+	ts := httptest.NewServer(sumdb.NewServer(sumdb.NewTestServer(skey, func(path, version string) ([]byte, error) {
+		lookups.Add(1)
+		if path != testModule || version != testVersion {
+			return nil, os.ErrNotExist
+		}
+		return lines, nil
+	})))
+	t.Cleanup(ts.Close)
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewVerifier(context.Background(), database.GetConnection(), store, config.SumDB{
+		Enabled: true,
+		Name:    testName,
+		Key:     vkey,
+		URL:     ts.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, lookups
+}
+
+func writeZip(t *testing.T, source string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(testGoMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "hello.go"), []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "*.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err = modzip.CreateFromDir(f, module.Version{Path: testModule, Version: testVersion}, dir); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
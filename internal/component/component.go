@@ -1,9 +1,18 @@
 package component
 
 import (
+	"context"
+	"errors"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
 	"github.com/inovacc/moonlight/internal/cron"
 	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/installer"
 	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/mirror"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/inovacc/moonlight/internal/upgrade"
+	"github.com/inovacc/moonlight/internal/vuln"
 	"github.com/inovacc/moonlight/pkg/versions"
 	"github.com/spf13/cobra"
 	"log/slog"
@@ -20,37 +29,169 @@ func Run(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
+	if err = schedule(cmd.Context(), c); err != nil {
+		return err
+	}
+
+	slog.Info("Main component started")
+
+	for {
+		select {
+		case <-cmd.Context().Done():
+			return nil
+		}
+	}
+}
+
+// schedule registers the catalog refresh and every enabled background job
+func schedule(ctx context.Context, c *cron.Cron) error {
+	var syncer *mirror.Syncer
+	if profile := config.GetConfig.Mirror.Profile; profile.Enabled {
+		var err error
+		if syncer, err = newMirrorSyncer(ctx, profile); err != nil {
+			return err
+		}
+	}
+
 	job := func() {
 		slog.Info("Running job")
 
 		goVer, err := versions.NewGoVersion()
 		if err != nil {
 			slog.Error(err.Error())
+			return
 		}
 
-		mapVerse, err := mapper.NewMapVersions(cmd.Context(), database.GetConnection(), goVer)
+		mapVerse, err := mapper.NewMapVersions(ctx, database.GetConnection(), goVer)
 		if err != nil {
 			slog.Error(err.Error())
+			return
 		}
 
 		latestVersion, err := mapVerse.GetLatest()
 		if err != nil {
 			slog.Error(err.Error())
+			return
 		}
 
 		slog.Info(latestVersion.StableVersion)
+
+		if release := mapVerse.NewRelease(); release != "" {
+			slog.Info("new stable release", "version", release)
+		}
+
+		// downloads can outlast the minute, a sync still running is not
+		// started again
+		if syncer != nil {
+			go syncer.TryRun()
+		}
+
+		if config.GetConfig.Upgrade.Enabled {
+			if err = runUpgrade(ctx, mapVerse); err != nil {
+				slog.Error(err.Error())
+			}
+		}
 	}
 
-	if _, err = c.AddFunc("*/1 * * * *", job); err != nil {
+	if _, err := c.AddFunc(cron.Minute, job); err != nil {
 		return err
 	}
 
-	slog.Info("Main component started")
+	if scrub := config.GetConfig.Scrub; scrub.Enabled {
+		m, err := newManager(ctx, nil)
+		if err != nil {
+			return err
+		}
 
-	for {
-		select {
-		case <-cmd.Context().Done():
-			return nil
+		if err = m.CronJob(scrub.Schedule, scrub.Repair, c); err != nil {
+			return err
+		}
+	}
+
+	if tools := config.GetConfig.Tools; tools.Enabled {
+		i, err := installer.NewInstaller(ctx, database.GetConnection())
+		if err != nil {
+			return err
+		}
+
+		if err = i.CronJob(tools.Schedule, tools.Upgrade, c); err != nil {
+			return err
+		}
+	}
+
+	if v := config.GetConfig.Vuln; v.Enabled {
+		return startVulnScan(ctx, v, c)
+	}
+	return nil
+}
+
+// startVulnScan schedules the import of the vulnerability database and the
+// scan of the installed tools and toolchains
+func startVulnScan(ctx context.Context, v config.Vuln, c *cron.Cron) error {
+	if v.Source == "" {
+		return errors.New("vuln.source must name the OSV database directory or zip")
+	}
+
+	db, err := vuln.NewDB(ctx, database.GetConnection())
+	if err != nil {
+		return err
+	}
+
+	i, err := installer.NewInstaller(ctx, database.GetConnection())
+	if err != nil {
+		return err
+	}
+
+	m, err := newManager(ctx, nil)
+	if err != nil {
+		return err
+	}
+	return db.CronJob(v.Schedule, v.Source, i, m, c)
+}
+
+// runUpgrade moves the configured channels to their newest patch release
+func runUpgrade(ctx context.Context, catalog *mapper.MapVersions) error {
+	m, err := newManager(ctx, catalog)
+	if err != nil {
+		return err
+	}
+
+	u, err := upgrade.NewUpgrader(ctx, database.GetConnection(), m, config.GetConfig.Upgrade)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.Run()
+	return err
+}
+
+// newMirrorSyncer returns the syncer pre-fetching the files selected by the
+// mirror profile, from the catalog kept up to date by the catalog job
+func newMirrorSyncer(ctx context.Context, profile config.MirrorProfile) (*mirror.Syncer, error) {
+	catalog, err := mapper.NewMapVersions(ctx, database.GetConnection(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := artifact.NewStore(config.GetConfig.Paths.CacheDir())
+	if err != nil {
+		return nil, err
+	}
+	return mirror.NewSyncer(catalog, store, profile), nil
+}
+
+// newManager opens the toolchain manager, with a query only catalog when none is given
+func newManager(ctx context.Context, catalog *mapper.MapVersions) (*toolchain.Manager, error) {
+	var err error
+	if catalog == nil {
+		if catalog, err = mapper.NewMapVersions(ctx, database.GetConnection(), nil); err != nil {
+			return nil, err
 		}
 	}
+
+	store, err := artifact.NewStore(config.GetConfig.Paths.CacheDir())
+	if err != nil {
+		return nil, err
+	}
+	return toolchain.NewManager(ctx, database.GetConnection(), catalog, store, config.GetConfig.Paths.ToolchainsDir())
 }
@@ -0,0 +1,53 @@
+package component
+
+import (
+	"context"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/cron"
+	"github.com/inovacc/moonlight/internal/database/databasetest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSchedule(t *testing.T) {
+	databasetest.Open(t)
+	config.GetConfig.Paths.Home = t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	c, err := cron.NewCronScheduler(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the catalog refresh alone
+	if err = schedule(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, c.Len())
+
+	config.GetConfig.Mirror.Profile.Enabled = true
+	config.GetConfig.Scrub.Enabled = true
+	config.GetConfig.Tools.Enabled = true
+	config.GetConfig.Vuln.Enabled = true
+	config.GetConfig.Vuln.Source = t.TempDir()
+	t.Cleanup(func() {
+		config.GetConfig.Mirror.Profile.Enabled = false
+		config.GetConfig.Scrub.Enabled = false
+		config.GetConfig.Tools.Enabled = false
+		config.GetConfig.Vuln.Enabled = false
+		config.GetConfig.Vuln.Source = ""
+	})
+
+	if c, err = cron.NewCronScheduler(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// every enabled job is registered with the default schedules, the
+	// mirror sync follows the catalog job
+	if err = schedule(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, c.Len())
+}
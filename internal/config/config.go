@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/spf13/viper"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 var GetConfig *Config
@@ -20,9 +22,54 @@ func init() {
 			Dbname: "store",
 			DBPath: os.TempDir(),
 		},
+		Paths: Paths{
+			Home: defaultHome(),
+		},
+		Upgrade: Upgrade{
+			Channels: []string{"global"},
+			Keep:     2,
+		},
+		Server: Server{
+			Addr: ":8080",
+		},
+		Scrub: Scrub{
+			Schedule: "@daily",
+		},
+		Tools: Tools{
+			Schedule: "@daily",
+			Keep:     2,
+		},
+		Vuln: Vuln{
+			Schedule: "@hourly",
+		},
+		Mirror: Mirror{
+			Upstream: "https://go.dev/dl",
+		},
+		Proxy: Proxy{
+			Upstream: "https://proxy.golang.org",
+			SumDB: SumDB{
+				Enabled: true,
+				Name:    "sum.golang.org",
+				Key:     "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+				URL:     "https://sum.golang.org",
+			},
+		},
 	}
 }
 
+// defaultHome returns MOONLIGHT_HOME or ~/.moonlight
+func defaultHome() string {
+	if home := os.Getenv("MOONLIGHT_HOME"); home != "" {
+		return home
+	}
+
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "moonlight")
+	}
+	return filepath.Join(dir, ".moonlight")
+}
+
 const (
 	SQLiteNamedDriver string = "sqlite"
 )
@@ -43,8 +90,16 @@ const (
 )
 
 type Config struct {
-	Logger Logger `yaml:"logger" mapstructure:"logger" json:"logger"`
-	Db     Db     `yaml:"db" mapstructure:"db" json:"db"`
+	Logger  Logger  `yaml:"logger" mapstructure:"logger" json:"logger"`
+	Db      Db      `yaml:"db" mapstructure:"db" json:"db"`
+	Paths   Paths   `yaml:"paths" mapstructure:"paths" json:"paths"`
+	Upgrade Upgrade `yaml:"upgrade" mapstructure:"upgrade" json:"upgrade"`
+	Server  Server  `yaml:"server" mapstructure:"server" json:"server"`
+	Scrub   Scrub   `yaml:"scrub" mapstructure:"scrub" json:"scrub"`
+	Mirror  Mirror  `yaml:"mirror" mapstructure:"mirror" json:"mirror"`
+	Proxy   Proxy   `yaml:"proxy" mapstructure:"proxy" json:"proxy"`
+	Tools   Tools   `yaml:"tools" mapstructure:"tools" json:"tools"`
+	Vuln    Vuln    `yaml:"vuln" mapstructure:"vuln" json:"vuln"`
 }
 
 type Logger struct {
@@ -58,6 +113,124 @@ type Db struct {
 	DBPath string `yaml:"dbPath" mapstructure:"dbPath" json:"dbPath"`
 }
 
+type Paths struct {
+	Home string `yaml:"home" mapstructure:"home" json:"home"`
+}
+
+// BinDir returns the directory holding the shims, it must be on PATH
+func (p Paths) BinDir() string {
+	return filepath.Join(p.Home, "bin")
+}
+
+// ToolchainsDir returns the directory where toolchains are extracted
+func (p Paths) ToolchainsDir() string {
+	return filepath.Join(p.Home, "toolchains")
+}
+
+// ToolsDir returns the directory holding a GOBIN per tool module version
+func (p Paths) ToolsDir() string {
+	return filepath.Join(p.Home, "tools")
+}
+
+// CacheDir returns the root of the artifact store
+func (p Paths) CacheDir() string {
+	return filepath.Join(p.Home, "cache")
+}
+
+// Upgrade is the automatic patch release policy. Channels are the aliases
+// moved to new releases: stable, a release line such as 1.22, or any other
+// alias like global which follows the line of its current version. A
+// release is adopted once it has been seen for Delay, Keep previous
+// installs of every channel stay around for rollback
+type Upgrade struct {
+	Enabled  bool          `yaml:"enabled" mapstructure:"enabled" json:"enabled"`
+	Channels []string      `yaml:"channels" mapstructure:"channels" json:"channels"`
+	Delay    time.Duration `yaml:"delay" mapstructure:"delay" json:"delay"`
+	Keep     int           `yaml:"keep" mapstructure:"keep" json:"keep"`
+}
+
+type Server struct {
+	Addr string `yaml:"addr" mapstructure:"addr" json:"addr"`
+}
+
+// Scrub re-hashes the installed toolchains on Schedule, drifted trees are
+// re-extracted from their archive when Repair is set
+type Scrub struct {
+	Enabled  bool   `yaml:"enabled" mapstructure:"enabled" json:"enabled"`
+	Schedule string `yaml:"schedule" mapstructure:"schedule" json:"schedule"`
+	Repair   bool   `yaml:"repair" mapstructure:"repair" json:"repair"`
+}
+
+// Tools checks the installed tools for newer versions on Schedule, outdated
+// tools are upgraded within their version constraint when Upgrade is set.
+// Keep previous versions of every tool stay installed for rollback, SBOM
+// writes the SBOMs of every install into the artifact store
+type Tools struct {
+	Enabled  bool   `yaml:"enabled" mapstructure:"enabled" json:"enabled"`
+	Schedule string `yaml:"schedule" mapstructure:"schedule" json:"schedule"`
+	Upgrade  bool   `yaml:"upgrade" mapstructure:"upgrade" json:"upgrade"`
+	Keep     int    `yaml:"keep" mapstructure:"keep" json:"keep"`
+	SBOM     bool   `yaml:"sbom" mapstructure:"sbom" json:"sbom"`
+}
+
+// Vuln imports Source, an OSV vulnerability database directory or zip, on
+// Schedule when it changed and re-scans the installed tools and toolchains
+type Vuln struct {
+	Enabled  bool   `yaml:"enabled" mapstructure:"enabled" json:"enabled"`
+	Source   string `yaml:"source" mapstructure:"source" json:"source"`
+	Schedule string `yaml:"schedule" mapstructure:"schedule" json:"schedule"`
+}
+
+// Mirror is where release files come from, the server fetches files missing
+// from the cache from Upstream only when PullThrough is set
+type Mirror struct {
+	Upstream    string        `yaml:"upstream" mapstructure:"upstream" json:"upstream"`
+	PullThrough bool          `yaml:"pullThrough" mapstructure:"pullThrough" json:"pullThrough"`
+	Profile     MirrorProfile `yaml:"profile" mapstructure:"profile" json:"profile"`
+}
+
+// MirrorProfile selects the files pre-fetched after each catalog sync.
+// Versions is a constraint such as >=1.21, Channels are stable and unstable,
+// Platforms are os/arch pairs and Kinds are archive, installer or source.
+// Empty lists select everything except Channels, which defaults to stable
+type MirrorProfile struct {
+	Enabled   bool     `yaml:"enabled" mapstructure:"enabled" json:"enabled"`
+	Versions  string   `yaml:"versions" mapstructure:"versions" json:"versions"`
+	Channels  []string `yaml:"channels" mapstructure:"channels" json:"channels"`
+	Platforms []string `yaml:"platforms" mapstructure:"platforms" json:"platforms"`
+	Kinds     []string `yaml:"kinds" mapstructure:"kinds" json:"kinds"`
+}
+
+// Proxy is the module proxy served next to the mirror, modules missing from
+// the cache come from Upstream, or from Repos for private modules. The
+// installer uses GoProxy as its GOPROXY when set, e.g. the URL of the
+// moonlight server itself
+type Proxy struct {
+	Upstream string `yaml:"upstream" mapstructure:"upstream" json:"upstream"`
+	GoProxy  string `yaml:"goProxy" mapstructure:"goProxy" json:"goProxy"`
+	SumDB    SumDB  `yaml:"sumdb" mapstructure:"sumdb" json:"sumdb"`
+	Repos    []Repo `yaml:"repos" mapstructure:"repos" json:"repos"`
+}
+
+// Repo maps the modules under a path prefix to a git remote, a local path or
+// an ssh URL such as git@git.corp.example:tools.git. A module below the prefix
+// lives in the matching subdirectory and is tagged <subdir>/vX.Y.Z
+type Repo struct {
+	Prefix string `yaml:"prefix" mapstructure:"prefix" json:"prefix"`
+	URL    string `yaml:"url" mapstructure:"url" json:"url"`
+}
+
+// SumDB is the checksum database module files are verified against before
+// they are cached, it is also proxied for GOPROXY clients. Modules matching
+// Private, a GONOSUMDB style pattern list, are not checked
+type SumDB struct {
+	Enabled bool   `yaml:"enabled" mapstructure:"enabled" json:"enabled"`
+	Name    string `yaml:"name" mapstructure:"name" json:"name"`
+	Key     string `yaml:"key" mapstructure:"key" json:"key"`
+	URL     string `yaml:"url" mapstructure:"url" json:"url"`
+	Private string `yaml:"private" mapstructure:"private" json:"private"`
+}
+
 type OptsFunc func(*Config)
 
 // WithSqliteDB sets sqlite db path name
@@ -85,6 +258,34 @@ func WithLogFormat(logFormat LogFormat) OptsFunc {
 	}
 }
 
+// WithHome sets the moonlight home directory
+func WithHome(home string) OptsFunc {
+	return func(o *Config) {
+		o.Paths.Home = home
+	}
+}
+
+// WithServerAddr sets the address the mirror server listens on
+func WithServerAddr(addr string) OptsFunc {
+	return func(o *Config) {
+		o.Server.Addr = addr
+	}
+}
+
+// WithUpstream sets the base URL release files are downloaded from
+func WithUpstream(upstream string) OptsFunc {
+	return func(o *Config) {
+		o.Mirror.Upstream = upstream
+	}
+}
+
+// WithGoProxy sets the GOPROXY used by the installer
+func WithGoProxy(goProxy string) OptsFunc {
+	return func(o *Config) {
+		o.Proxy.GoProxy = goProxy
+	}
+}
+
 // NewConfig creates a new service configuration
 func NewConfig(opts ...OptsFunc) {
 	for _, fn := range opts {
@@ -93,7 +294,7 @@ func NewConfig(opts ...OptsFunc) {
 }
 
 func SetConfig(cfgFile string) {
-	if cfgFile != "" {
+	if cfgFile == "" {
 		cfgFile = os.Getenv("CONFIG_FILE")
 	}
 
@@ -80,6 +80,11 @@ func (c *Cron) AddFunc(spec string, cmd func()) (int, error) {
 	return int(id), err
 }
 
+// Len returns the number of scheduled jobs
+func (c *Cron) Len() int {
+	return len(c.cron.Entries())
+}
+
 func fixWeekday(spec string) string {
 	switch spec {
 	case Weekday:
@@ -0,0 +1,23 @@
+// Package databasetest opens throwaway databases for tests
+package databasetest
+
+import (
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/jmoiron/sqlx"
+	"testing"
+)
+
+// Open points the configuration at a temporary directory, opens the
+// database there and closes it when the test ends
+func Open(t testing.TB) *sqlx.DB {
+	t.Helper()
+
+	config.GetConfig.Db.DBPath = t.TempDir()
+	if err := database.NewDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(database.CloseConnection)
+
+	return database.GetConnection()
+}
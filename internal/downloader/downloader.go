@@ -3,19 +3,29 @@ package downloader
 import (
 	"crypto/sha256"
 	"fmt"
+	"github.com/inovacc/moonlight/internal/config"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
 	goUrl = "https://go.dev/dl"
 )
 
+// upstream returns the configured mirror, go.dev by default
+func upstream() string {
+	if u := config.GetConfig.Mirror.Upstream; u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return goUrl
+}
+
 func DownloadGoVersion(filename, hash, dest string) error {
-	downloadUrl := fmt.Sprintf("%s/%s", goUrl, filename)
+	downloadUrl := fmt.Sprintf("%s/%s", upstream(), filename)
 	u, err := url.Parse(downloadUrl)
 	if err != nil {
 		return fmt.Errorf("error parsing url: %w", err)
@@ -40,10 +50,13 @@ func DownloadGoVersion(filename, hash, dest string) error {
 
 	destPath := filepath.Join(dest, filename)
 
-	out, err := os.Create(destPath)
+	// download next to the destination so a failed or tampered
+	// transfer never leaves a file under the final name
+	out, err := os.CreateTemp(dest, "."+filename+".*")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(out.Name())
 	defer out.Close()
 
 	h := sha256.New()
@@ -58,5 +71,9 @@ func DownloadGoVersion(filename, hash, dest string) error {
 		return fmt.Errorf("hash mismatch: expected %s, got %x", hash, h.Sum(nil))
 	}
 
-	return nil
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), destPath)
 }
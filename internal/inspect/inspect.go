@@ -0,0 +1,115 @@
+package inspect
+
+import (
+	"errors"
+	"github.com/inovacc/moonlight/internal/installer"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/vuln"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Report is what is known about a Go binary: its build info, where its Go
+// version stands in the support window and the vulnerabilities it embeds.
+// Support is nil when the catalog cannot place the version, Vulns is only
+// meaningful when VulnChecked is set
+type Report struct {
+	Path        string               `json:"path"`
+	Build       *installer.BuildInfo `json:"build,omitempty"`
+	Support     *mapper.Support      `json:"support,omitempty"`
+	VulnChecked bool                 `json:"vuln_checked"`
+	Vulns       []*vuln.Finding      `json:"vulns,omitempty"`
+	Error       string               `json:"error,omitempty"`
+}
+
+// Inspector reads Go binaries and cross-references them with the release
+// catalog and the vulnerability database, both are optional
+type Inspector struct {
+	catalog *mapper.MapVersions
+	vulns   *vuln.DB
+}
+
+// NewInspector returns an inspector, an empty vulnerability database is not
+// used so reports do not claim a clean bill of health
+func NewInspector(catalog *mapper.MapVersions, vulns *vuln.DB) (*Inspector, error) {
+	i := &Inspector{catalog: catalog}
+	if vulns != nil {
+		n, err := vulns.Count()
+		if err != nil {
+			return nil, err
+		}
+
+		if n > 0 {
+			i.vulns = vulns
+		}
+	}
+	return i, nil
+}
+
+// Inspect reads the build info of a binary, a file that is not a Go binary
+// gets a report with the error
+func (i *Inspector) Inspect(path string) (*Report, error) {
+	r := &Report{Path: path}
+
+	b, err := installer.ReadBuildInfo(path)
+	if err != nil {
+		r.Error = strings.TrimPrefix(err.Error(), path+": ")
+		return r, nil
+	}
+	r.Build = b
+
+	if i.catalog != nil {
+		s, err := i.catalog.Support(b.GoRelease())
+		switch {
+		case err == nil:
+			r.Support = s
+		case !errors.Is(err, mapper.ErrEmptyCatalog) && !errors.Is(err, mapper.ErrInvalidVersion):
+			return nil, err
+		}
+	}
+
+	if i.vulns != nil {
+		if r.Vulns, err = i.vulns.Check(vuln.ToolTarget(path, b)); err != nil {
+			return nil, err
+		}
+		r.VulnChecked = true
+	}
+	return r, nil
+}
+
+// InspectAll inspects files and the Go binaries below directories, files of
+// a directory that are not Go binaries are skipped
+func (i *Inspector) InspectAll(paths []string) ([]*Report, error) {
+	var reports []*Report
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, de fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if de.IsDir() || !de.Type().IsRegular() {
+				return nil
+			}
+
+			r, err := i.Inspect(p)
+			if err != nil {
+				return err
+			}
+
+			if r.Build != nil || p == path {
+				reports = append(reports, r)
+			}
+			return nil
+		})
+
+		if err != nil {
+			var pathErr *fs.PathError
+			if !errors.As(err, &pathErr) || pathErr.Path != path {
+				return nil, err
+			}
+			reports = append(reports, &Report{Path: path, Error: err.Error()})
+		}
+	}
+	return reports, nil
+}
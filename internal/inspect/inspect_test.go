@@ -0,0 +1,118 @@
+package inspect
+
+import (
+	"context"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/database/databasetest"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/vuln"
+	"github.com/inovacc/moonlight/pkg/versions"
+	"github.com/stretchr/testify/assert"
+	goversion "go/version"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const entryStdlib = `{
+  "id": "GO-2024-0002",
+  "modified": "2024-03-01T00:00:00Z",
+  "published": "2024-02-01T00:00:00Z",
+  "affected": [{
+    "package": {"name": "stdlib", "ecosystem": "Go"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}],
+    "ecosystem_specific": {"imports": [{"path": "net/http", "symbols": ["Serve"]}]}
+  }]
+}`
+
+func TestInspect(t *testing.T) {
+	databasetest.Open(t)
+
+	// the test binary is a Go binary built by the running toolchain
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := goversion.Lang(runtime.Version())
+
+	goVer := &versions.GoVersion{StableVersion: line + ".99"}
+	for _, v := range []string{line + ".99", "go1.10.8", "go1.9.7"} {
+		goVer.Versions = append(goVer.Versions, versions.Versions{
+			Version: v,
+			Stable:  true,
+			Files:   []versions.File{{Filename: v + ".src.tar.gz", Os: "any", Arch: "any", Sha256: v, Kind: "source"}},
+		})
+	}
+
+	catalog, err := mapper.NewMapVersions(context.Background(), database.GetConnection(), goVer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vulns, err := vuln.NewDB(context.Background(), database.GetConnection())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty vulnerability database is not consulted
+	inspector, err := NewInspector(catalog, vulns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := inspector.Inspect(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "github.com/inovacc/moonlight", r.Build.Module)
+	assert.False(t, r.VulnChecked)
+	if assert.NotNil(t, r.Support) {
+		assert.True(t, r.Support.Supported)
+		assert.Equal(t, line+".99", r.Support.Latest)
+	}
+
+	source := t.TempDir()
+	if err = os.WriteFile(filepath.Join(source, "GO-2024-0002.json"), []byte(entryStdlib), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = vulns.Import(source); err != nil {
+		t.Fatal(err)
+	}
+
+	if inspector, err = NewInspector(catalog, vulns); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string][]byte{"tool": data, "README": []byte("not a binary")} {
+		if err = os.WriteFile(filepath.Join(dir, name), content, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notGo := filepath.Join(dir, "README")
+	reports, err := inspector.InspectAll([]string{dir, notGo, filepath.Join(dir, "missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// files of a directory that are not Go binaries are skipped
+	if assert.Len(t, reports, 3) {
+		assert.Equal(t, filepath.Join(dir, "tool"), reports[0].Path)
+		assert.True(t, reports[0].VulnChecked)
+		if assert.Len(t, reports[0].Vulns, 1) {
+			assert.Equal(t, []string{"net/http.Serve"}, reports[0].Vulns[0].Symbols)
+		}
+
+		assert.Equal(t, notGo, reports[1].Path)
+		assert.Nil(t, reports[1].Build)
+		assert.NotEmpty(t, reports[1].Error)
+
+		assert.NotEmpty(t, reports[2].Error)
+	}
+}
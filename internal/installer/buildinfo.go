@@ -0,0 +1,234 @@
+package installer
+
+import (
+	"context"
+	"database/sql"
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"runtime/debug"
+	"strings"
+)
+
+const (
+	createTableBuild = `CREATE TABLE IF NOT EXISTS tool_build (
+    installer_id INTEGER PRIMARY KEY,
+    path TEXT NOT NULL,
+    module TEXT NOT NULL,
+    version TEXT NOT NULL,
+    sum TEXT NOT NULL,
+    go_version TEXT NOT NULL,
+    tags TEXT NOT NULL,
+    ldflags TEXT NOT NULL,
+    cgo_enabled TEXT NOT NULL,
+    goos TEXT NOT NULL,
+    goarch TEXT NOT NULL,
+    vcs_revision TEXT NOT NULL,
+    vcs_time TEXT NOT NULL,
+    vcs_modified TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (installer_id) REFERENCES installer(id)
+)`
+
+	createTableBuildSetting = `CREATE TABLE IF NOT EXISTS tool_build_setting (
+    installer_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (installer_id, key),
+    FOREIGN KEY (installer_id) REFERENCES installer(id)
+)`
+
+	createTableDependency = `CREATE TABLE IF NOT EXISTS tool_dependency (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    installer_id INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    version TEXT NOT NULL,
+    sum TEXT NOT NULL,
+    replace_path TEXT NOT NULL,
+    replace_version TEXT NOT NULL,
+    FOREIGN KEY (installer_id) REFERENCES installer(id)
+)`
+
+	createIndexDependency = `CREATE INDEX IF NOT EXISTS tool_dependency_module ON tool_dependency (path, version)`
+
+	insertBuildQuery      = `INSERT OR REPLACE INTO tool_build (installer_id, path, module, version, sum, go_version, tags, ldflags, cgo_enabled, goos, goarch, vcs_revision, vcs_time, vcs_modified) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertSettingQuery    = `INSERT OR REPLACE INTO tool_build_setting (installer_id, key, value) VALUES (?, ?, ?)`
+	insertDependencyQuery = `INSERT INTO tool_dependency (installer_id, path, version, sum, replace_path, replace_version) VALUES (?, ?, ?, ?, ?, ?)`
+	selectBuildQuery      = `SELECT installer_id, path, module, version, sum, go_version, tags, ldflags, cgo_enabled, goos, goarch, vcs_revision, vcs_time, vcs_modified FROM tool_build WHERE installer_id = ?`
+	selectSettingsQuery   = `SELECT key, value FROM tool_build_setting WHERE installer_id = ? ORDER BY key`
+	selectDepsQuery       = `SELECT path, version, sum, replace_path, replace_version FROM tool_dependency WHERE installer_id = ? ORDER BY path`
+	selectEmbeddingQuery  = `SELECT i.id, i.version, i.module, i.package, i.query, i.build_flags, i.env, i.binary_name FROM installer i WHERE i.id IN (SELECT installer_id FROM tool_dependency WHERE path = ? AND (? = '' OR version = ?) UNION SELECT installer_id FROM tool_build WHERE module = ? AND (? = '' OR version = ?)) ORDER BY i.id`
+	deleteBuildQuery      = `DELETE FROM tool_build WHERE installer_id = ?`
+	deleteSettingsQuery   = `DELETE FROM tool_build_setting WHERE installer_id = ?`
+	deleteDepsQuery       = `DELETE FROM tool_dependency WHERE installer_id = ?`
+)
+
+var ErrNoBuildInfo = errors.New("no build info recorded")
+
+// BuildInfo is what the go command embedded into an installed binary: the
+// main package and module, the toolchain, the build settings and every
+// module linked in
+type BuildInfo struct {
+	InstallID   int           `json:"install_id" db:"installer_id"`
+	Path        string        `json:"path" db:"path"`
+	Module      string        `json:"module" db:"module"`
+	Version     string        `json:"version" db:"version"`
+	Sum         string        `json:"sum,omitempty" db:"sum"`
+	GoVersion   string        `json:"go_version" db:"go_version"`
+	Tags        string        `json:"tags,omitempty" db:"tags"`
+	Ldflags     string        `json:"ldflags,omitempty" db:"ldflags"`
+	CgoEnabled  string        `json:"cgo_enabled,omitempty" db:"cgo_enabled"`
+	GOOS        string        `json:"goos" db:"goos"`
+	GOARCH      string        `json:"goarch" db:"goarch"`
+	VCSRevision string        `json:"vcs_revision,omitempty" db:"vcs_revision"`
+	VCSTime     string        `json:"vcs_time,omitempty" db:"vcs_time"`
+	VCSModified string        `json:"vcs_modified,omitempty" db:"vcs_modified"`
+	Settings    []*Setting    `json:"settings,omitempty" db:"-"`
+	Deps        []*Dependency `json:"deps,omitempty" db:"-"`
+}
+
+// GoRelease returns the Go version without the experiments following it, as
+// in go1.22.1 X:boringcrypto
+func (b *BuildInfo) GoRelease() string {
+	version, _, _ := strings.Cut(b.GoVersion, " ")
+	return version
+}
+
+// Setting is a build setting such as -tags or GOARCH
+type Setting struct {
+	Key   string `json:"key" db:"key"`
+	Value string `json:"value" db:"value"`
+}
+
+// Dependency is a module linked into a binary, Sum is the go.sum hash of the
+// replacement when the module is replaced
+type Dependency struct {
+	Path           string `json:"path" db:"path"`
+	Version        string `json:"version" db:"version"`
+	Sum            string `json:"sum,omitempty" db:"sum"`
+	ReplacePath    string `json:"replace_path,omitempty" db:"replace_path"`
+	ReplaceVersion string `json:"replace_version,omitempty" db:"replace_version"`
+}
+
+// ReadBuildInfo reads the build info embedded into a Go binary
+func ReadBuildInfo(exe string) (*BuildInfo, error) {
+	bi, err := buildinfo.ReadFile(exe)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", exe, err)
+	}
+
+	b := &BuildInfo{
+		Path:      bi.Path,
+		Module:    bi.Main.Path,
+		Version:   bi.Main.Version,
+		Sum:       bi.Main.Sum,
+		GoVersion: bi.GoVersion,
+	}
+
+	for _, s := range bi.Settings {
+		b.Settings = append(b.Settings, &Setting{Key: s.Key, Value: s.Value})
+
+		switch s.Key {
+		case "-tags":
+			b.Tags = s.Value
+		case "-ldflags":
+			b.Ldflags = s.Value
+		case "CGO_ENABLED":
+			b.CgoEnabled = s.Value
+		case "GOOS":
+			b.GOOS = s.Value
+		case "GOARCH":
+			b.GOARCH = s.Value
+		case "vcs.revision":
+			b.VCSRevision = s.Value
+		case "vcs.time":
+			b.VCSTime = s.Value
+		case "vcs.modified":
+			b.VCSModified = s.Value
+		}
+	}
+
+	for _, m := range bi.Deps {
+		b.Deps = append(b.Deps, dependency(m))
+	}
+	return b, nil
+}
+
+// BuildInfo returns the recorded build info of an install
+func (i *Installer) BuildInfo(in *Install) (*BuildInfo, error) {
+	var b BuildInfo
+	if err := i.db.GetContext(i.ctx, &b, selectBuildQuery, in.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s@%s: %w", in.Binary(), in.Version, ErrNoBuildInfo)
+		}
+		return nil, err
+	}
+
+	if err := i.db.SelectContext(i.ctx, &b.Settings, selectSettingsQuery, in.ID); err != nil {
+		return nil, err
+	}
+
+	if err := i.db.SelectContext(i.ctx, &b.Deps, selectDepsQuery, in.ID); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Embedding returns the installs whose binary links a module, at a version
+// or at any version when version is empty
+func (i *Installer) Embedding(modulePath, version string) ([]*Install, error) {
+	var list []*Install
+	if err := i.db.SelectContext(i.ctx, &list, selectEmbeddingQuery, modulePath, version, version, modulePath, version, version); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// recordBuild reads the build info of an installed binary and stores it
+// for the install
+func recordBuild(ctx context.Context, tx *sqlx.Tx, installerID int64, exe string) error {
+	b, err := ReadBuildInfo(exe)
+	if err != nil {
+		return err
+	}
+
+	if err = deleteBuild(ctx, tx, installerID); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, insertBuildQuery, installerID, b.Path, b.Module, b.Version, b.Sum, b.GoVersion, b.Tags, b.Ldflags, b.CgoEnabled, b.GOOS, b.GOARCH, b.VCSRevision, b.VCSTime, b.VCSModified); err != nil {
+		return err
+	}
+
+	for _, s := range b.Settings {
+		if _, err = tx.ExecContext(ctx, insertSettingQuery, installerID, s.Key, s.Value); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range b.Deps {
+		if _, err = tx.ExecContext(ctx, insertDependencyQuery, installerID, d.Path, d.Version, d.Sum, d.ReplacePath, d.ReplaceVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBuild removes the recorded build info of an install
+func deleteBuild(ctx context.Context, tx *sqlx.Tx, installerID int64) error {
+	for _, query := range []string{deleteDepsQuery, deleteSettingsQuery, deleteBuildQuery} {
+		if _, err := tx.ExecContext(ctx, query, installerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dependency(m *debug.Module) *Dependency {
+	d := &Dependency{Path: m.Path, Version: m.Version, Sum: m.Sum}
+	if m.Replace != nil {
+		d.ReplacePath, d.ReplaceVersion, d.Sum = m.Replace.Path, m.Replace.Version, m.Replace.Sum
+	}
+	return d
+}
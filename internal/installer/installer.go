@@ -5,25 +5,33 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Masterminds/semver/v3"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
 	"github.com/inovacc/moonlight/internal/cron"
+	"github.com/inovacc/moonlight/internal/modproxy"
 	"github.com/jmoiron/sqlx"
-	"github.com/spf13/afero"
-	"net/url"
+	"log/slog"
+	"os"
 	"os/exec"
-	"sort"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
 )
 
-const commandPrefixGo = "go"
-const commandPrefixInstall = "install"
-
 const (
 	createTable = `CREATE TABLE IF NOT EXISTS installer (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     version TEXT NOT NULL,
     command TEXT NOT NULL,
     dependencies TEXT NOT NULL,
+    module TEXT NOT NULL DEFAULT '',
+    package TEXT NOT NULL DEFAULT '',
+    query TEXT NOT NULL DEFAULT '',
+    build_flags TEXT NOT NULL DEFAULT '[]',
+    env TEXT NOT NULL DEFAULT '[]',
+    binary_name TEXT NOT NULL DEFAULT '',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 )`
@@ -44,13 +52,28 @@ const (
     FOREIGN KEY (installer_id) REFERENCES installer(id)
 )`
 
-	insertQuery  = `INSERT INTO installer (version, command, dependencies) VALUES (?, ?, ?) RETURNING id`
-	insertModule = `INSERT INTO module (path, version, query, versions_history, time, dir, go_mod, go_version, installer_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	selectAll    = `SELECT * FROM installer`
-	selectOne    = `SELECT * FROM installer WHERE version = ?`
+	insertQuery      = `INSERT INTO installer (version, command, dependencies, module, package, query, build_flags, env, binary_name) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	insertModule     = `INSERT INTO module (path, version, query, versions_history, time, dir, go_mod, go_version, installer_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	selectAll        = `SELECT id, version, module, package, query, build_flags, env, binary_name FROM installer ORDER BY id`
+	selectLegacy     = `SELECT id, command FROM installer WHERE package = ''`
+	updateSpecQuery  = `UPDATE installer SET module = ?, package = ?, query = ?, build_flags = ?, env = ?, binary_name = ? WHERE id = ?`
+	deleteInstall    = `DELETE FROM installer WHERE id = ?`
+	deleteModules    = `DELETE FROM module WHERE installer_id = ?`
+	tableInfoQuery   = `SELECT name FROM pragma_table_info('installer')`
+	addColumnQuery   = `ALTER TABLE installer ADD COLUMN %s %s`
+	installerTimeout = 5 * time.Minute
 )
 
-var cronId int
+// specColumns are the installer columns added when commands became specs,
+// older databases get them through migrate
+var specColumns = []struct{ name, definition string }{
+	{"module", "TEXT NOT NULL DEFAULT ''"},
+	{"package", "TEXT NOT NULL DEFAULT ''"},
+	{"query", "TEXT NOT NULL DEFAULT ''"},
+	{"build_flags", "TEXT NOT NULL DEFAULT '[]'"},
+	{"env", "TEXT NOT NULL DEFAULT '[]'"},
+	{"binary_name", "TEXT NOT NULL DEFAULT ''"},
+}
 
 type File struct {
 	ID       int    `json:"id,omitempty" db:"id"`
@@ -64,32 +87,39 @@ type File struct {
 	URL      string `json:"url,omitempty" db:"url"`
 }
 
+// Install is a recorded tool install, Version is the resolved version of the
+// spec query
 type Install struct {
-	ID      int    `json:"id,omitempty" db:"id"`
-	Version string `json:"version,omitempty" db:"version"`
-	Command string `json:"command,omitempty" db:"command"`
-}
-
-type Module struct {
-	Path      string    `json:"path,omitempty"`
-	Version   string    `json:"version,omitempty"`
-	Query     string    `json:"query,omitempty"`
-	Versions  []string  `json:"versions,omitempty"`
-	Time      time.Time `json:"time,omitempty"`
-	Dir       string    `json:"dir,omitempty"`
-	GoMod     string    `json:"go_mod,omitempty"`
-	GoVersion string    `json:"go_version,omitempty"`
+	ID         int    `json:"id,omitempty" db:"id"`
+	Version    string `json:"version,omitempty" db:"version"`
+	Module     string `json:"module,omitempty" db:"module"`
+	Package    string `json:"package,omitempty" db:"package"`
+	Query      string `json:"query,omitempty" db:"query"`
+	BuildFlags string `json:"build_flags,omitempty" db:"build_flags"`
+	Env        string `json:"env,omitempty" db:"env"`
+	BinaryName string `json:"binary_name,omitempty" db:"binary_name"`
 }
 
 type Installer struct {
-	db  *sqlx.DB
-	ctx context.Context
+	db       *sqlx.DB
+	ctx      context.Context
+	client   *modproxy.Client
+	toolsDir string
+	binDir   string
+	keep     int
+
+	// sbomStore receives the SBOMs of new installs when set
+	sbomStore *artifact.Store
 }
 
 func NewInstaller(ctx context.Context, db *sqlx.DB) (*Installer, error) {
 	i := &Installer{
-		db:  db,
-		ctx: ctx,
+		db:       db,
+		ctx:      ctx,
+		client:   modproxy.NewClientFromEnv(),
+		toolsDir: config.GetConfig.Paths.ToolsDir(),
+		binDir:   config.GetConfig.Paths.BinDir(),
+		keep:     config.GetConfig.Tools.Keep,
 	}
 
 	if _, err := i.db.ExecContext(ctx, createTable); err != nil {
@@ -100,168 +130,405 @@ func NewInstaller(ctx context.Context, db *sqlx.DB) (*Installer, error) {
 		return nil, err
 	}
 
+	for _, query := range []string{createTableBuild, createTableBuildSetting, createTableDependency, createIndexDependency} {
+		if _, err := i.db.ExecContext(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := i.db.ExecContext(ctx, createTableLink); err != nil {
+		return nil, err
+	}
+
+	if _, err := i.db.ExecContext(ctx, createTableLinkHistory); err != nil {
+		return nil, err
+	}
+
+	if err := i.migrate(); err != nil {
+		return nil, err
+	}
+
+	if config.GetConfig.Tools.SBOM {
+		store, err := artifact.NewStore(config.GetConfig.Paths.CacheDir())
+		if err != nil {
+			return nil, err
+		}
+		i.sbomStore = store
+	}
+
 	return i, nil
 }
 
-func (i *Installer) CronJob(spec string, cron *cron.Cron) error {
-	var err error
-	cronId, err = cron.AddFunc(spec, func() {
-		// Do something
-	})
-	if err != nil {
+// migrate adds the spec columns to an installer table created before them
+// and fills them in from the recorded command lines
+func (i *Installer) migrate() error {
+	var columns []string
+	if err := i.db.SelectContext(i.ctx, &columns, tableInfoQuery); err != nil {
 		return err
 	}
+
+	for _, c := range specColumns {
+		if slices.Contains(columns, c.name) {
+			continue
+		}
+
+		if _, err := i.db.ExecContext(i.ctx, fmt.Sprintf(addColumnQuery, c.name, c.definition)); err != nil {
+			return fmt.Errorf("add installer column %s: %w", c.name, err)
+		}
+	}
+
+	var legacy []struct {
+		ID      int    `db:"id"`
+		Command string `db:"command"`
+	}
+	if err := i.db.SelectContext(i.ctx, &legacy, selectLegacy); err != nil {
+		return err
+	}
+
+	for _, row := range legacy {
+		spec, err := ParseCommand(row.Command)
+		if err != nil {
+			slog.Warn("installer migration skipped a command", "id", row.ID, "command", row.Command, "error", err)
+			continue
+		}
+
+		flags, env, err := encodeSpec(spec)
+		if err != nil {
+			return err
+		}
+
+		if _, err = i.db.ExecContext(i.ctx, updateSpecQuery, spec.Module, spec.Package, spec.Version, flags, env, spec.BinaryName, row.ID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (i *Installer) Command(command string) error {
-	ctxTimeout, cancel := context.WithTimeout(i.ctx, 5*time.Minute)
-	defer cancel()
+// Installs returns the recorded installs, oldest first
+func (i *Installer) Installs() ([]*Install, error) {
+	var list []*Install
+	if err := i.db.SelectContext(i.ctx, &list, selectAll); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
 
-	parsedCommand := strings.Split(command, " ")
+// Spec returns the tool spec of a recorded install
+func (in *Install) Spec() (*ToolSpec, error) {
+	spec := &ToolSpec{
+		Module:     in.Module,
+		Package:    in.Package,
+		Version:    in.Query,
+		BinaryName: in.BinaryName,
+	}
 
-	if !strings.HasPrefix(parsedCommand[0], commandPrefixGo) {
-		return fmt.Errorf("invalid command, must have prefix %s", commandPrefixGo)
+	if err := json.Unmarshal([]byte(in.BuildFlags), &spec.BuildFlags); err != nil {
+		return nil, err
 	}
 
-	if !strings.HasPrefix(parsedCommand[1], commandPrefixInstall) {
-		return fmt.Errorf("invalid command, must have prefix %s", commandPrefixInstall)
+	if err := json.Unmarshal([]byte(in.Env), &spec.Env); err != nil {
+		return nil, err
 	}
+	return spec, spec.Validate()
+}
 
-	afs := afero.NewOsFs()
-	tmpDir, err := afero.TempDir(afs, "", "go-list")
+// CronJob schedules a check of the installed tools for newer versions,
+// outdated tools are upgraded within their constraint when upgrade is set
+func (i *Installer) CronJob(spec string, upgrade bool, cron *cron.Cron) error {
+	_, err := cron.AddFunc(spec, func() {
+		outdated, err := i.Outdated()
+		if err != nil {
+			slog.Error(err.Error())
+		}
+
+		for _, o := range outdated {
+			slog.Info("outdated tool", "tool", o.Binary, "current", o.Current, "latest", o.Latest, "allowed", o.Allowed, "constraint", o.Constraint)
+		}
+
+		if !upgrade {
+			return
+		}
+
+		upgraded, err := i.Upgrade(outdated)
+		if err != nil {
+			slog.Error(err.Error())
+		}
+
+		for _, o := range upgraded {
+			slog.Info("tool upgraded", "tool", o.Binary, "from", o.Current, "to", o.Allowed)
+		}
+	})
+	return err
+}
+
+// Command installs a tool from a go install command line
+func (i *Installer) Command(command string) error {
+	spec, err := ParseCommand(command)
 	if err != nil {
 		return err
 	}
-	defer func(afs afero.Fs, path string) {
-		if err = afs.RemoveAll(path); err != nil {
-			fmt.Println(err)
-		}
-	}(afs, tmpDir)
+	return i.Install(spec)
+}
+
+// Install resolves the module and version of a spec, installs it and records
+// the install
+func (i *Installer) Install(spec *ToolSpec) error {
+	return i.install(spec, spec.Version)
+}
+
+// install installs the version a query selects and records the spec query,
+// so a constraint stays the query of a pinned install
+func (i *Installer) install(spec *ToolSpec, query string) error {
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(i.ctx, installerTimeout)
+	defer cancel()
 
-	urlList := strings.Split(parsedCommand[2], "@")
-	if len(urlList) != 2 {
-		return fmt.Errorf("invalid url")
+	// the module root is the package path or one of its parents
+	path := spec.Package
+	if spec.Module != "" {
+		path = spec.Module
 	}
 
-	parsedCommand[2], err = getBaseURL(urlList[0])
+	module, err := i.resolve(ctxTimeout, path, query)
 	if err != nil {
 		return err
 	}
+	module.Query = spec.Version
 
-	execCommand := strings.Split(fmt.Sprintf("go list -m -json -versions %s", parsedCommand[2]), " ")
-	cmd := exec.CommandContext(ctxTimeout, execCommand[0], execCommand[1:]...)
-	cmd.Dir = tmpDir
+	target := *spec
+	target.Version = module.Version
 
-	out, err := cmd.CombinedOutput()
+	// every module version gets its own GOBIN so versions live side by side
+	dir, err := i.versionDir(module.Path, module.Version)
 	if err != nil {
 		return err
 	}
 
-	var module Module
-	if err = json.Unmarshal(out, &module); err != nil {
-		return err
+	out, err := goCommand(ctxTimeout, target.Args(), append(slices.Clone(spec.Env), "GOBIN="+dir)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", target.String(), err, out)
 	}
 
-	if module.Version == "" {
-		stableVersions := filterAndSortStableVersions(module.Versions)
-		if len(stableVersions) > 0 {
-			module.Version = stableVersions[0]
+	if spec.BinaryName != "" {
+		if err = rename(dir, spec); err != nil {
+			return err
 		}
 	}
 
-	execCommand = strings.Split(fmt.Sprintf("go install %s@%s", urlList[0], module.Version), " ")
+	moduleStr := strings.Join(module.Versions, ",")
 
-	if module.Version == "" {
-		execCommand = strings.Split(command, " ")
+	if spec.Module == "" {
+		spec.Module = module.Path
 	}
-	cmd = exec.CommandContext(ctxTimeout, execCommand[0], execCommand[1:]...)
 
-	out, err = cmd.CombinedOutput()
+	flags, env, err := encodeSpec(spec)
 	if err != nil {
 		return err
 	}
 
-	dependencies := strings.ReplaceAll(string(out), "go: downloading ", "")
-	dependencies = strings.ReplaceAll(dependencies, "go: extracting ", "")
-	dependencies = strings.ReplaceAll(dependencies, "go: finding ", "")
-	dependencies = strings.ReplaceAll(dependencies, "go: found ", "")
-
-	moduleStr := strings.Join(module.Versions, ",")
-
 	tx, err := i.db.BeginTxx(ctxTimeout, nil)
 	if err != nil {
 		return err
 	}
 
 	var installerID int64
-	if err = tx.QueryRowContext(ctxTimeout, insertQuery, module.Version, command, dependencies).Scan(&installerID); err != nil {
+	if err = tx.QueryRowContext(ctxTimeout, insertQuery, module.Version, spec.String(), "", spec.Module, spec.Package, spec.Version, flags, env, spec.BinaryName).Scan(&installerID); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	_, err = tx.ExecContext(ctxTimeout, insertModule, module.Path, module.Version, module.Query, moduleStr, module.Time, module.Dir, module.GoMod, module.GoVersion, installerID)
+	_, err = tx.ExecContext(ctxTimeout, insertModule, module.Path, module.Version, module.Query, moduleStr, module.Time, "", "", module.GoVersion, installerID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	// the binary itself tells what was built, the dependencies column
+	// of older records holds the go command output
+	if err = recordBuild(ctxTimeout, tx, installerID, filepath.Join(dir, exeName(spec.Binary()))); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return err
 	}
 
+	in := &Install{
+		ID:         int(installerID),
+		Version:    module.Version,
+		Module:     spec.Module,
+		Package:    spec.Package,
+		Query:      spec.Version,
+		BuildFlags: flags,
+		Env:        env,
+		BinaryName: spec.BinaryName,
+	}
+
+	if err = i.activate(in); err != nil {
+		return err
+	}
+
+	// tools sbom generates it again from the build info, a failure does not
+	// fail a working install
+	if i.sbomStore != nil {
+		if err = i.storeSBOM(in); err != nil {
+			slog.Warn("sbom not stored", "tool", target.String(), "error", err)
+		}
+	}
 	return nil
 }
 
-func getBaseURL(rawURL string) (string, error) {
-	parsedURL, err := url.Parse(rawURL)
+// Uninstall removes the link, every installed version and every install
+// record of a tool
+func (i *Installer) Uninstall(in *Install) error {
+	spec, err := in.Spec()
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	// Split the path into segments
-	segments := strings.Split(parsedURL.Path, "/")
+	ctxTimeout, cancel := context.WithTimeout(i.ctx, installerTimeout)
+	defer cancel()
+
+	if err = os.Remove(filepath.Join(i.binDir, exeName(spec.Binary()))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// tools installed before versions lived side by side are in GOBIN
+	legacyDir, err := binDir(ctxTimeout, spec.Env)
+	if err != nil {
+		return err
+	}
 
-	// Find the index of "cmd"
-	cmdIndex := -1
-	for i, segment := range segments {
-		if segment == "cmd" {
-			cmdIndex = i
-			break
+	if err = os.Remove(filepath.Join(legacyDir, exeName(spec.Binary()))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	installs, err := i.Installs()
+	if err != nil {
+		return err
+	}
+
+	for _, other := range installs {
+		if other.Package == "" || other.Binary() != spec.Binary() {
+			continue
+		}
+
+		if err = i.remove(other); err != nil {
+			return err
 		}
 	}
 
-	// If "cmd" is found, create the base path without "cmd" and the following segment
-	if cmdIndex != -1 && cmdIndex+1 < len(segments) {
-		basePath := strings.Join(segments[:cmdIndex], "/")
-		parsedURL.Path = basePath
+	if _, err = i.db.ExecContext(ctxTimeout, deleteLinkQuery, spec.Binary()); err != nil {
+		return err
 	}
 
-	return parsedURL.String(), nil
+	_, err = i.db.ExecContext(ctxTimeout, deleteLinksHistoryQuery, spec.Binary())
+	return err
 }
 
-func filterAndSortStableVersions(versions []string) []string {
-	// Filter out pre-release versions
-	var stableVersions []*semver.Version
-	for _, v := range versions {
-		ver, err := semver.NewVersion(strings.TrimPrefix(v, "v"))
-		if err != nil {
+// Binary returns the name of the installed binary
+func (in *Install) Binary() string {
+	spec := &ToolSpec{Package: in.Package, BinaryName: in.BinaryName}
+	return spec.Binary()
+}
+
+// resolve finds the module of a path and the version a query selects, semver
+// constraints such as ^1.2 pick the newest matching release
+func (i *Installer) resolve(ctx context.Context, path, query string) (*modproxy.Resolved, error) {
+	if !isConstraint(query) {
+		return i.client.Resolve(ctx, path, query)
+	}
+
+	c, err := semver.NewConstraint(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid version constraint %q: %w", ErrInvalidSpec, query, err)
+	}
+
+	// find the module root first, latest is the cheapest query
+	latest, err := i.client.Resolve(ctx, path, latestQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	for j := len(latest.Versions) - 1; j >= 0; j-- {
+		v, err := semver.NewVersion(latest.Versions[j])
+		if err != nil || !c.Check(v) {
 			continue
 		}
-		if ver.Prerelease() == "" {
-			stableVersions = append(stableVersions, ver)
+
+		r, err := i.client.Resolve(ctx, latest.Path, latest.Versions[j])
+		if err != nil {
+			return nil, err
 		}
+		r.Query = query
+		return r, nil
 	}
+	return nil, fmt.Errorf("%s: no version matches %q: %w", latest.Path, query, modproxy.ErrNotFound)
+}
 
-	// Sort the stable versions
-	sort.Slice(stableVersions, func(i, j int) bool {
-		return stableVersions[i].GreaterThan(stableVersions[j])
-	})
+// rename gives the binary installed into dir the name the spec asks for
+func rename(dir string, spec *ToolSpec) error {
+	built := *spec
+	built.BinaryName = ""
+	return os.Rename(filepath.Join(dir, exeName(built.Binary())), filepath.Join(dir, exeName(spec.BinaryName)))
+}
+
+// binDir returns the directory go install writes binaries to
+func binDir(ctx context.Context, env []string) (string, error) {
+	out, err := goCommand(ctx, []string{"go", "env", "GOBIN", "GOPATH"}, env...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	dir := strings.TrimSpace(lines[0])
+	if dir == "" && len(lines) > 1 {
+		gopath := strings.TrimSpace(lines[1])
+		dir = filepath.Join(filepath.SplitList(gopath)[0], "bin")
+	}
+	return dir, nil
+}
+
+func exeName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// encodeSpec returns the build flags and env of a spec as stored
+func encodeSpec(spec *ToolSpec) (string, string, error) {
+	flags, err := json.Marshal(nonNil(spec.BuildFlags))
+	if err != nil {
+		return "", "", err
+	}
+
+	env, err := json.Marshal(nonNil(spec.Env))
+	if err != nil {
+		return "", "", err
+	}
+	return string(flags), string(env), nil
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
 
-	// Convert back to string slice
-	var result = make([]string, 0)
-	for _, v := range stableVersions {
-		result = append(result, fmt.Sprintf("v%s", v.String()))
+// goCommand prepares a go command with extra env, using the configured module
+// proxy when set
+func goCommand(ctx context.Context, args []string, env ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = os.Environ()
+	if goProxy := config.GetConfig.Proxy.GoProxy; goProxy != "" {
+		cmd.Env = append(cmd.Env, "GOPROXY="+goProxy)
 	}
-	return result
+	cmd.Env = append(cmd.Env, env...)
+	return cmd
 }
@@ -1,8 +1,27 @@
 package installer
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/cron"
 	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/database/databasetest"
+	"github.com/inovacc/moonlight/internal/modproxy"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"testing"
 )
 
@@ -131,3 +150,627 @@ func TestNewInstaller(t *testing.T) {
 		t.Errorf("Expected no errors but got %v", errList)
 	}
 }
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    ToolSpec
+	}{
+		{
+			command: "go install github.com/spf13/cobra-cli@latest",
+			want:    ToolSpec{Package: "github.com/spf13/cobra-cli", Version: "latest"},
+		},
+		{
+			command: "go install github.com/vugu/vgrun",
+			want:    ToolSpec{Package: "github.com/vugu/vgrun", Version: "latest"},
+		},
+		{
+			command: "go install athens github.com/gomods/athens/cmd/proxy@latest",
+			want:    ToolSpec{Package: "github.com/gomods/athens/cmd/proxy", Version: "latest", BinaryName: "athens"},
+		},
+		{
+			command: "go install github.com/gomods/athens/cmd/proxy@latest -o athens",
+			want:    ToolSpec{Package: "github.com/gomods/athens/cmd/proxy", Version: "latest", BinaryName: "athens"},
+		},
+		{
+			command: "go install github.com/dyammarcano/version@add-cli",
+			want:    ToolSpec{Package: "github.com/dyammarcano/version", Version: "add-cli"},
+		},
+		{
+			command: `CGO_ENABLED=0 go install -trimpath -tags "netgo osusergo" -ldflags='-s -w -X main.version=1.0' honnef.co/go/tools/cmd/staticcheck@v0.4.7`,
+			want: ToolSpec{
+				Package:    "honnef.co/go/tools/cmd/staticcheck",
+				Version:    "v0.4.7",
+				BuildFlags: []string{"-trimpath", "-tags=netgo osusergo", "-ldflags=-s -w -X main.version=1.0"},
+				Env:        []string{"CGO_ENABLED=0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		spec, err := ParseCommand(tt.command)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.command, err)
+		}
+		assert.Equal(t, tt.want, *spec, tt.command)
+
+		// the canonical command line reads back to the same spec
+		again, err := ParseCommand(spec.String())
+		if err != nil {
+			t.Fatalf("%s: %v", spec.String(), err)
+		}
+		assert.Equal(t, spec, again, spec.String())
+	}
+
+	for _, bad := range []string{
+		"",
+		"go build github.com/spf13/cobra-cli@latest",
+		"go install",
+		"go install -o",
+		"go install -tags",
+		"go install -bogus github.com/spf13/cobra-cli@latest",
+		"go install github.com/a/b@v1 github.com/c/d@v2",
+		`go install "github.com/spf13/cobra-cli@latest`,
+		"go install github.com/spf13/cobra-cli@latest -o ../evil",
+		"go install athens proxy github.com/gomods/athens/cmd/proxy@latest",
+	} {
+		_, err := ParseCommand(bad)
+		assert.True(t, errors.Is(err, ErrInvalidSpec), "%q: %v", bad, err)
+	}
+}
+
+func TestToolSpecBinary(t *testing.T) {
+	assert.Equal(t, "staticcheck", (&ToolSpec{Package: "honnef.co/go/tools/cmd/staticcheck"}).Binary())
+	assert.Equal(t, "goose", (&ToolSpec{Package: "github.com/pressly/goose/v3/cmd/goose"}).Binary())
+	assert.Equal(t, "kratos", (&ToolSpec{Package: "github.com/go-kratos/kratos/cmd/kratos/v2"}).Binary())
+	assert.Equal(t, "athens", (&ToolSpec{Package: "github.com/gomods/athens/cmd/proxy", BinaryName: "athens"}).Binary())
+}
+
+func TestMigrate(t *testing.T) {
+	databasetest.Open(t)
+
+	// an installer table from before specs
+	db := database.GetConnection()
+	db.MustExec(`CREATE TABLE installer (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version TEXT NOT NULL,
+    command TEXT NOT NULL,
+    dependencies TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`)
+	db.MustExec(`INSERT INTO installer (version, command, dependencies) VALUES (?, ?, ?)`, "v0.4.7", "go install -ldflags '-s -w' honnef.co/go/tools/cmd/staticcheck@latest", "")
+	db.MustExec(`INSERT INTO installer (version, command, dependencies) VALUES (?, ?, ?)`, "v1.0.0", "go install athens", "")
+
+	installer, err := NewInstaller(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// opening twice is a no-op
+	if installer, err = NewInstaller(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := installer.Installs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, list, 2)
+
+	spec, err := list[0].Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "honnef.co/go/tools/cmd/staticcheck", spec.Package)
+	assert.Equal(t, "latest", spec.Version)
+	assert.Equal(t, []string{"-ldflags=-s -w"}, spec.BuildFlags)
+	assert.Equal(t, "v0.4.7", list[0].Version)
+
+	// unparseable commands are kept as they are
+	assert.Equal(t, "", list[1].Package)
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	path := writeManifest(t, dir, `tools:
+  - package: golang.org/x/tools/gopls
+  - package: honnef.co/go/tools/cmd/staticcheck
+    version: ^0.4
+    buildFlags: [-trimpath]
+  - package: github.com/gomods/athens/cmd/proxy
+    binaryName: athens
+    go: 1.22.5
+`)
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, m.Tools, 3)
+
+	spec, err := m.Tools[2].Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "latest", spec.Version)
+	assert.Equal(t, []string{"MOONLIGHT_GO_VERSION=go1.22.5", "GOTOOLCHAIN=go1.22.5"}, spec.Env)
+
+	for _, bad := range []string{
+		"tools:\n  - package: golang.org/x/tools/gopls\n    verison: v0.16.0\n",
+		"tools:\n  - package: example.com/a/cmd/x\n  - package: example.com/b/cmd/x\n",
+		"tools:\n  - package: not a package\n",
+	} {
+		_, err = LoadManifest(writeManifest(t, dir, bad))
+		assert.Error(t, err, bad)
+	}
+
+	for _, bad := range []string{"stable", "default", "1.x"} {
+		_, err = LoadManifest(writeManifest(t, dir, "tools:\n  - package: golang.org/x/tools/gopls\n    go: "+bad+"\n"))
+		assert.True(t, errors.Is(err, ErrInvalidSpec), "%q: %v", bad, err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	i := newTestInstaller(t)
+
+	record(t, i, &ToolSpec{Package: "example.com/tool/cmd/a", Version: "^1.0"}, "v1.0.0")
+	record(t, i, &ToolSpec{Package: "example.com/tool/cmd/c", Version: "latest"}, "v1.1.0")
+	record(t, i, &ToolSpec{Package: "example.com/tool/cmd/d", Version: "latest"}, "v1.1.0")
+	record(t, i, &ToolSpec{Package: "example.com/tool/cmd/e", Version: "latest"}, "v1.1.0")
+
+	changes, err := i.Plan(&Manifest{Tools: []*ManifestTool{
+		{Package: "example.com/tool/cmd/a", Version: "^1.0"},
+		{Package: "example.com/tool/cmd/b"},
+		{Package: "example.com/tool/cmd/c", BuildFlags: []string{"-trimpath"}},
+		{Package: "example.com/tool/cmd/e"},
+		{Package: "example.com/tool/cmd/f", Version: "~1.0"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Action+" "+c.Binary+" "+c.From+" "+c.To)
+	}
+	assert.Equal(t, []string{
+		"update a v1.0.0 v1.1.0",
+		"install b  v1.1.0",
+		"reinstall c v1.1.0 v1.1.0",
+		"keep e v1.1.0 v1.1.0",
+		"install f  v1.0.0",
+		"remove d v1.1.0 ",
+	}, got)
+
+	// constraints nothing satisfies fail the plan
+	_, err = i.Plan(&Manifest{Tools: []*ManifestTool{{Package: "example.com/tool/cmd/a", Version: ">=2.0"}}})
+	assert.True(t, errors.Is(err, modproxy.ErrNotFound), err)
+}
+
+// newTestInstaller returns an installer resolving example.com/tool, which has
+// v1.0.0 and v1.1.0, from a test proxy
+func newTestInstaller(t *testing.T) *Installer {
+	t.Helper()
+
+	databasetest.Open(t)
+	config.GetConfig.Paths.Home = t.TempDir()
+
+	files := map[string]string{
+		"/example.com/tool/@v/list":        "v1.0.0\nv1.1.0\n",
+		"/example.com/tool/@v/v1.0.0.info": `{"Version":"v1.0.0","Time":"2024-01-01T00:00:00Z"}`,
+		"/example.com/tool/@v/v1.1.0.info": `{"Version":"v1.1.0","Time":"2024-02-01T00:00:00Z"}`,
+		"/example.com/tool/@v/v1.0.0.mod":  "module example.com/tool\n\ngo 1.21\n",
+		"/example.com/tool/@v/v1.1.0.mod":  "module example.com/tool\n\ngo 1.22\n",
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, data)
+	}))
+	t.Cleanup(proxy.Close)
+
+	i, err := NewInstaller(context.Background(), database.GetConnection())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.client = modproxy.NewClient(proxy.URL, "")
+	return i
+}
+
+// record stores an install without running go install
+func record(t *testing.T, i *Installer, spec *ToolSpec, version string) {
+	t.Helper()
+
+	flags, env, err := encodeSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = i.db.Exec(insertQuery, version, spec.String(), "", "example.com/tool", spec.Package, spec.Version, flags, env, spec.BinaryName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeManifest(t *testing.T, dir, data string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, DefaultManifest)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOutdated(t *testing.T) {
+	i := newTestInstaller(t)
+
+	record(t, i, &ToolSpec{Package: "example.com/tool/cmd/a", Version: "~1.0"}, "v1.0.0")
+	record(t, i, &ToolSpec{Package: "example.com/tool/cmd/b", Version: "latest"}, "v1.0.0")
+	record(t, i, &ToolSpec{Package: "example.com/tool/cmd/c", Version: "latest"}, "v1.1.0")
+	record(t, i, &ToolSpec{Package: "example.com/tool/cmd/d", Version: "v1.0.0"}, "v1.0.0")
+
+	outdated, err := i.Outdated()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, o := range outdated {
+		got = append(got, fmt.Sprintf("%s %s %s %s %v", o.Binary, o.Current, o.Allowed, o.Latest, o.Upgradable()))
+	}
+	assert.Equal(t, []string{
+		"a v1.0.0 v1.0.0 v1.1.0 false",
+		"b v1.0.0 v1.1.0 v1.1.0 true",
+		"d v1.0.0 v1.0.0 v1.1.0 false",
+	}, got)
+
+	c, err := cron.NewCronScheduler(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the scheduler takes a seconds field, five field specs are rejected
+	assert.Error(t, i.CronJob("*/5 * * * *", false, c))
+
+	if err = i.CronJob(config.GetConfig.Tools.Schedule, true, c); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestUseRollback(t *testing.T) {
+	i := newTestInstaller(t)
+	i.keep = 1
+
+	spec := &ToolSpec{Package: "example.com/tool/cmd/a", Version: "latest"}
+	paths := make(map[string]string)
+	for _, v := range []string{"v1.0.0", "v1.1.0", "v1.2.0"} {
+		record(t, i, spec, v)
+
+		installs, err := i.Installs()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		in := installs[len(installs)-1]
+		path, err := i.Path(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = os.WriteFile(path, []byte(in.Version), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		paths[in.Version] = path
+
+		// installing a version makes it the active one
+		if err = i.activate(in); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	linked := func() string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(i.binDir, exeName("a")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	assert.Equal(t, "v1.2.0", linked())
+
+	// one previous version is kept
+	_, err := os.Stat(paths["v1.0.0"])
+	assert.True(t, os.IsNotExist(err), err)
+	_, err = os.Stat(paths["v1.1.0"])
+	assert.NoError(t, err)
+
+	installs, err := i.Installs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, installs, 2)
+
+	version, err := i.Rollback("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "v1.1.0", version)
+	assert.Equal(t, "v1.1.0", linked())
+
+	current, err := i.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "v1.1.0", current[0].Version)
+
+	// the pruned version left no history behind
+	_, err = i.Rollback("a")
+	assert.True(t, errors.Is(err, ErrNoHistory), err)
+
+	if err = i.Use("a", "1.2.0"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "v1.2.0", linked())
+
+	err = i.Use("a", "v1.0.0")
+	assert.True(t, errors.Is(err, ErrNotInstalled), err)
+
+	if err = i.Uninstall(current[0]); err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Lstat(filepath.Join(i.binDir, exeName("a")))
+	assert.True(t, os.IsNotExist(err), err)
+	_, err = os.Stat(i.toolsDir + "/example.com")
+	assert.True(t, os.IsNotExist(err), err)
+}
+
+func TestBuildInfo(t *testing.T) {
+	i := newTestInstaller(t)
+	in := recordTestBuild(t, i)
+
+	b, err := i.BuildInfo(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "github.com/inovacc/moonlight", b.Module)
+	assert.Equal(t, runtime.Version(), b.GoVersion)
+	assert.Equal(t, runtime.GOOS, b.GOOS)
+	assert.NotEmpty(t, b.Settings)
+
+	var testify *Dependency
+	for _, d := range b.Deps {
+		if d.Path == "github.com/stretchr/testify" {
+			testify = d
+		}
+	}
+	if testify == nil {
+		t.Fatal("testify missing from the dependencies")
+	}
+	assert.NotEmpty(t, testify.Sum)
+
+	embedding, err := i.Embedding(testify.Path, testify.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, embedding, 1)
+
+	embedding, err = i.Embedding(testify.Path, "v0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, embedding)
+
+	_, err = i.BuildInfo(&Install{ID: 42})
+	assert.True(t, errors.Is(err, ErrNoBuildInfo), err)
+	b.GoVersion = "go1.22.1 X:boringcrypto"
+	assert.Equal(t, "go1.22.1", b.GoRelease())
+}
+
+func TestSBOM(t *testing.T) {
+	i := newTestInstaller(t)
+	in := recordTestBuild(t, i)
+
+	data, err := i.SBOM(in, FormatCycloneDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bom cdxBOM
+	if err = json.Unmarshal(data, &bom); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "CycloneDX", bom.BOMFormat)
+	assert.Equal(t, "github.com/inovacc/moonlight", bom.Metadata.Component.Name)
+	assert.Equal(t, "pkg:golang/std@"+runtime.Version(), bom.Components[0].PURL)
+	assert.Len(t, bom.Dependencies[0].DependsOn, len(bom.Components))
+
+	var testify *cdxComponent
+	for _, c := range bom.Components {
+		if c.Name == "github.com/stretchr/testify" {
+			testify = c
+		}
+	}
+	if testify == nil {
+		t.Fatal("testify missing from the components")
+	}
+	assert.Equal(t, "SHA-256", testify.Hashes[0].Alg)
+	assert.Len(t, testify.Hashes[0].Content, 64)
+
+	if data, err = i.SBOM(in, FormatSPDX); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc spdxDocument
+	if err = json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "SPDX-2.3", doc.SPDXVersion)
+	assert.Equal(t, "a@v1.0.0", doc.Name)
+	assert.Equal(t, "SPDXRef-Package-main", doc.Relationships[0].RelatedSPDXElement)
+	assert.Len(t, doc.Packages, len(bom.Components)+1)
+
+	_, err = i.SBOM(in, "swid")
+	assert.True(t, errors.Is(err, ErrUnknownFormat), err)
+
+	// installs write both formats into the store when enabled
+	if i.sbomStore, err = artifact.NewStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err = i.storeSBOM(in); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, i.sbomStore.Has(artifact.SBOM, "a/v1.0.0.cdx.json"))
+	assert.True(t, i.sbomStore.Has(artifact.SBOM, "a/v1.0.0.spdx.json"))
+}
+
+// recordTestBuild records an install of a at v1.0.0 with the build info of
+// the test binary, which embeds it like any installed tool
+func recordTestBuild(t *testing.T, i *Installer) *Install {
+	t.Helper()
+	record(t, i, &ToolSpec{Package: "example.com/tool/cmd/a", Version: "latest"}, "v1.0.0")
+
+	installs, err := i.Installs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := i.db.MustBegin()
+	if err = recordBuild(i.ctx, tx, int64(installs[0].ID), exe); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return installs[0]
+}
+
+func TestInstall(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	i := newTestInstaller(t)
+	proxy := newModuleProxy(t, "example.com/hello", "v1.0.0", map[string]string{
+		"go.mod":            "module example.com/hello\n\ngo 1.21\n",
+		"cmd/hello/main.go": "package main\n\nfunc main() { println(\"hello\") }\n",
+	})
+	i.client = modproxy.NewClient(proxy, "")
+
+	// the go command builds from the fixture proxy only
+	saved := config.GetConfig.Proxy.GoProxy
+	config.GetConfig.Proxy.GoProxy = proxy
+	t.Cleanup(func() { config.GetConfig.Proxy.GoProxy = saved })
+	t.Setenv("GOENV", "off")
+	t.Setenv("GOFLAGS", "-mod=mod -modcacherw")
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GONOSUMDB", "example.com")
+	t.Setenv("GOPRIVATE", "")
+	t.Setenv("GOTOOLCHAIN", "local")
+
+	spec := &ToolSpec{Package: "example.com/hello/cmd/hello", Version: "latest", BinaryName: "hi"}
+	if err := i.Install(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	installs, err := i.Installs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, installs, 1) {
+		return
+	}
+	in := installs[0]
+	assert.Equal(t, "v1.0.0", in.Version)
+	assert.Equal(t, "hi", in.Binary())
+
+	// the binary is built into the GOBIN of its module version and renamed
+	dir, err := i.versionDir("example.com/hello", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := i.Path(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, filepath.Join(dir, exeName("hi")), path)
+	assert.FileExists(t, path)
+	assert.NoFileExists(t, filepath.Join(dir, exeName("hello")))
+
+	link := filepath.Join(i.binDir, exeName("hi"))
+	if target, err := os.Readlink(link); err == nil {
+		assert.Equal(t, path, target)
+	} else {
+		assert.FileExists(t, link)
+	}
+
+	active, err := i.Active("hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "v1.0.0", active)
+
+	// the build info comes from the installed binary
+	b, err := i.BuildInfo(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "example.com/hello", b.Module)
+	assert.Equal(t, "v1.0.0", b.Version)
+	assert.Equal(t, "example.com/hello/cmd/hello", b.Path)
+}
+
+// newModuleProxy serves a single module version over the GOPROXY protocol
+// and returns its URL
+func newModuleProxy(t *testing.T, modulePath, version string, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var zipData bytes.Buffer
+	if err := modzip.CreateFromDir(&zipData, module.Version{Path: modulePath, Version: version}, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	info := fmt.Sprintf(`{"Version":%q,"Time":"2024-01-01T00:00:00Z"}`, version)
+	served := map[string]string{
+		"/" + modulePath + "/@v/list":                 version + "\n",
+		"/" + modulePath + "/@latest":                 info,
+		"/" + modulePath + "/@v/" + version + ".info": info,
+		"/" + modulePath + "/@v/" + version + ".mod":  files["go.mod"],
+		"/" + modulePath + "/@v/" + version + ".zip":  zipData.String(),
+	}
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := served[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, data)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy.URL
+}
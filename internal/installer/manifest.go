@@ -0,0 +1,207 @@
+package installer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/resolver"
+	goversion "go/version"
+	"gopkg.in/yaml.v3"
+	"os"
+	"slices"
+)
+
+// DefaultManifest is the manifest file read by tools sync
+const DefaultManifest = "tools.yaml"
+
+// Actions of a sync plan
+const (
+	ActionInstall   = "install"
+	ActionUpdate    = "update"
+	ActionReinstall = "reinstall"
+	ActionRemove    = "remove"
+	ActionKeep      = "keep"
+)
+
+// Manifest is the desired toolset, usually read from tools.yaml
+type Manifest struct {
+	Tools []*ManifestTool `yaml:"tools" json:"tools"`
+}
+
+// ManifestTool is a tool of the manifest. Version is latest, a version, a
+// branch or a semver constraint such as ^1.2, Go the toolchain building it
+type ManifestTool struct {
+	Package    string   `yaml:"package" json:"package"`
+	Module     string   `yaml:"module,omitempty" json:"module,omitempty"`
+	Version    string   `yaml:"version,omitempty" json:"version,omitempty"`
+	BuildFlags []string `yaml:"buildFlags,omitempty" json:"buildFlags,omitempty"`
+	Env        []string `yaml:"env,omitempty" json:"env,omitempty"`
+	BinaryName string   `yaml:"binaryName,omitempty" json:"binaryName,omitempty"`
+	Go         string   `yaml:"go,omitempty" json:"go,omitempty"`
+}
+
+// Change is a step of a sync plan, From and To are the installed and the
+// desired version
+type Change struct {
+	Action  string
+	Binary  string
+	From    string
+	To      string
+	Spec    *ToolSpec
+	Install *Install
+}
+
+// LoadManifest reads and validates a manifest, unknown fields are errors so
+// typos do not go unnoticed
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var m Manifest
+	if err = dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	seen := make(map[string]string)
+	for _, tool := range m.Tools {
+		spec, err := tool.Spec()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, tool.Package, err)
+		}
+
+		if other, ok := seen[spec.Binary()]; ok {
+			return nil, fmt.Errorf("%s: %s and %s both install %s, set binaryName", path, other, tool.Package, spec.Binary())
+		}
+		seen[spec.Binary()] = tool.Package
+	}
+	return &m, nil
+}
+
+// Spec returns the tool spec of a manifest tool, the toolchain is selected
+// through the environment of the go command
+func (t *ManifestTool) Spec() (*ToolSpec, error) {
+	spec := &ToolSpec{
+		Module:     t.Module,
+		Package:    t.Package,
+		Version:    t.Version,
+		BuildFlags: t.BuildFlags,
+		Env:        slices.Clone(t.Env),
+		BinaryName: t.BinaryName,
+	}
+
+	if spec.Version == "" {
+		spec.Version = latestQuery
+	}
+
+	if t.Go != "" {
+		// aliases such as stable mean nothing to GOTOOLCHAIN
+		v := resolver.Normalize(t.Go)
+		if !goversion.IsValid(v) {
+			return nil, fmt.Errorf("%w: go %q is not a go version", ErrInvalidSpec, t.Go)
+		}
+
+		// the shim honors MOONLIGHT_GO_VERSION, a plain go command GOTOOLCHAIN
+		spec.Env = append(spec.Env, resolver.EnvVersion+"="+v, "GOTOOLCHAIN="+v)
+	}
+	return spec, spec.Validate()
+}
+
+// Plan compares the manifest with the recorded installs, every manifest tool
+// gets a change and installed tools missing from the manifest are removed
+func (i *Installer) Plan(m *Manifest) ([]*Change, error) {
+	installs, err := i.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]*Install, len(installs))
+	for _, in := range installs {
+		current[in.Binary()] = in
+	}
+
+	var changes []*Change
+	for _, tool := range m.Tools {
+		spec, err := tool.Spec()
+		if err != nil {
+			return nil, err
+		}
+
+		path := spec.Package
+		if spec.Module != "" {
+			path = spec.Module
+		}
+
+		resolved, err := i.resolve(i.ctx, path, spec.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Package, err)
+		}
+
+		c := &Change{Action: ActionInstall, Binary: spec.Binary(), To: resolved.Version, Spec: spec}
+		if in, ok := current[c.Binary]; ok {
+			delete(current, c.Binary)
+			c.Install, c.From = in, in.Version
+
+			installed, err := in.Spec()
+			switch {
+			case err != nil || !sameBuild(installed, spec):
+				c.Action = ActionReinstall
+			case in.Version != resolved.Version:
+				c.Action = ActionUpdate
+			default:
+				c.Action = ActionKeep
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	for binary, in := range current {
+		changes = append(changes, &Change{Action: ActionRemove, Binary: binary, From: in.Version, Install: in})
+	}
+
+	slices.SortStableFunc(changes, func(a, b *Change) int {
+		if a.Action == ActionRemove && b.Action != ActionRemove {
+			return 1
+		}
+		if b.Action == ActionRemove && a.Action != ActionRemove {
+			return -1
+		}
+		return 0
+	})
+	return changes, nil
+}
+
+// Sync applies a plan, a failing change does not stop the others
+func (i *Installer) Sync(changes []*Change) error {
+	var errs []error
+	for _, c := range changes {
+		var err error
+		switch c.Action {
+		case ActionInstall, ActionUpdate, ActionReinstall:
+			err = i.install(c.Spec, c.To)
+		case ActionRemove:
+			err = i.Uninstall(c.Install)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", c.Action, c.Binary, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sameBuild reports whether two specs build the same binary the same way,
+// versions are compared by the caller
+func sameBuild(a, b *ToolSpec) bool {
+	if b.Module != "" && a.Module != b.Module {
+		return false
+	}
+	return a.Package == b.Package &&
+		a.BinaryName == b.BinaryName &&
+		slices.Equal(a.BuildFlags, b.BuildFlags) &&
+		slices.Equal(a.Env, b.Env)
+}
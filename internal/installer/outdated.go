@@ -0,0 +1,108 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/mod/semver"
+)
+
+// Outdated is an installed tool with a newer version. Allowed is the newest
+// version its constraint accepts, Latest the newest version of its module
+type Outdated struct {
+	Binary     string   `json:"binary"`
+	Package    string   `json:"package"`
+	Constraint string   `json:"constraint"`
+	Current    string   `json:"current"`
+	Allowed    string   `json:"allowed"`
+	Latest     string   `json:"latest"`
+	Install    *Install `json:"-"`
+}
+
+// Upgradable reports whether the constraint allows a newer version
+func (o *Outdated) Upgradable() bool {
+	return semver.Compare(o.Allowed, o.Current) > 0
+}
+
+// Outdated checks every installed tool against the module proxy and returns
+// the ones with a newer version, allowed by their constraint or not
+func (i *Installer) Outdated() ([]*Outdated, error) {
+	installs, err := i.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		list []*Outdated
+		errs []error
+	)
+	for _, in := range installs {
+		o, err := i.outdated(in)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", in.Binary(), err))
+			continue
+		}
+
+		if semver.Compare(o.Latest, o.Current) > 0 || o.Upgradable() {
+			list = append(list, o)
+		}
+	}
+	return list, errors.Join(errs...)
+}
+
+// Upgrade installs the allowed version of the outdated tools, the ones
+// pinned by their constraint or rolled back from the allowed version are
+// skipped
+func (i *Installer) Upgrade(outdated []*Outdated) ([]*Outdated, error) {
+	var (
+		upgraded []*Outdated
+		errs     []error
+	)
+	for _, o := range outdated {
+		if !o.Upgradable() {
+			continue
+		}
+
+		if _, err := i.installed(o.Binary, o.Allowed); err == nil {
+			continue
+		}
+
+		spec, err := o.Install.Spec()
+		if err == nil {
+			err = i.install(spec, o.Allowed)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("upgrade %s: %w", o.Binary, err))
+			continue
+		}
+		upgraded = append(upgraded, o)
+	}
+	return upgraded, errors.Join(errs...)
+}
+
+func (i *Installer) outdated(in *Install) (*Outdated, error) {
+	path := in.Package
+	if in.Module != "" {
+		path = in.Module
+	}
+
+	allowed, err := i.resolve(i.ctx, path, in.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := i.client.Latest(i.ctx, allowed.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Outdated{
+		Binary:     in.Binary(),
+		Package:    in.Package,
+		Constraint: in.Query,
+		Current:    in.Version,
+		Allowed:    allowed.Version,
+		Latest:     latest.Version,
+		Install:    in,
+	}, nil
+}
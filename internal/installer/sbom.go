@@ -0,0 +1,315 @@
+package installer
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"strings"
+	"time"
+)
+
+// SBOM formats
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+)
+
+// Formats are the SBOM formats in the order they are generated
+var Formats = []string{FormatCycloneDX, FormatSPDX}
+
+var ErrUnknownFormat = errors.New("unknown sbom format")
+
+// sbomTool names the generator inside the documents
+const sbomTool = "moonlight"
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []*cdxComponent `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string        `json:"timestamp"`
+	Tools     cdxTools      `json:"tools"`
+	Component *cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []*cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Type       string        `json:"type"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Hashes     []cdxHash     `json:"hashes,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []*spdxPackage     `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// SBOM returns the SBOM of an install in a format, generated from its
+// recorded build info
+func (i *Installer) SBOM(in *Install, format string) ([]byte, error) {
+	b, err := i.BuildInfo(in)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateSBOM(in.Binary()+"@"+in.Version, b, format, time.Now())
+}
+
+// SBOMName returns the name of the SBOM of an install in the artifact store
+func SBOMName(in *Install, format string) string {
+	ext := ".cdx.json"
+	if format == FormatSPDX {
+		ext = ".spdx.json"
+	}
+	return in.Binary() + "/" + in.Version + ext
+}
+
+// GenerateSBOM builds the SBOM document of a binary from its build info,
+// name such as gopls@v0.16.1 names the document
+func GenerateSBOM(name string, b *BuildInfo, format string, created time.Time) ([]byte, error) {
+	switch format {
+	case FormatCycloneDX:
+		return json.MarshalIndent(cycloneDX(b, created), "", "  ")
+	case FormatSPDX:
+		return json.MarshalIndent(spdx(name, b, created), "", "  ")
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// storeSBOM writes the SBOMs of an install into the artifact store
+func (i *Installer) storeSBOM(in *Install) error {
+	for _, format := range Formats {
+		data, err := i.SBOM(in, format)
+		if err != nil {
+			return err
+		}
+
+		w, err := i.sbomStore.Create(artifact.SBOM, SBOMName(in, format))
+		if err != nil {
+			return err
+		}
+
+		if _, err = w.Write(data); err != nil {
+			w.Abort()
+			return err
+		}
+
+		if err = w.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cycloneDX(b *BuildInfo, created time.Time) *cdxBOM {
+	main := &cdxComponent{
+		BOMRef:  purl(b.Module, b.Version),
+		Type:    "application",
+		Name:    b.Module,
+		Version: b.Version,
+		PURL:    purl(b.Module, b.Version),
+		Hashes:  cdxHashes(b.Sum),
+	}
+
+	main.Properties = append(main.Properties, cdxProperty{Name: "golang:package", Value: b.Path})
+	for _, s := range b.Settings {
+		main.Properties = append(main.Properties, cdxProperty{Name: "golang:build:" + s.Key, Value: s.Value})
+	}
+
+	toolchain := &cdxComponent{
+		BOMRef:  purl("std", b.GoVersion),
+		Type:    "library",
+		Name:    "std",
+		Version: b.GoVersion,
+		PURL:    purl("std", b.GoVersion),
+	}
+
+	bom := &cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuid.NewString(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: created.UTC().Format(time.RFC3339),
+			Tools:     cdxTools{Components: []*cdxComponent{{Type: "application", Name: sbomTool}}},
+			Component: main,
+		},
+		Components: []*cdxComponent{toolchain},
+	}
+
+	dependsOn := []string{toolchain.BOMRef}
+	for _, d := range b.Deps {
+		c := &cdxComponent{
+			BOMRef:  purl(d.Path, d.Version),
+			Type:    "library",
+			Name:    d.Path,
+			Version: d.Version,
+			PURL:    purl(d.Path, d.Version),
+			Hashes:  cdxHashes(d.Sum),
+		}
+
+		if d.ReplacePath != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: "golang:replace", Value: strings.TrimSuffix(d.ReplacePath+"@"+d.ReplaceVersion, "@")})
+		}
+		bom.Components = append(bom.Components, c)
+		dependsOn = append(dependsOn, c.BOMRef)
+	}
+
+	bom.Dependencies = []cdxDependency{{Ref: main.BOMRef, DependsOn: dependsOn}}
+	for _, c := range bom.Components {
+		bom.Dependencies = append(bom.Dependencies, cdxDependency{Ref: c.BOMRef, DependsOn: []string{}})
+	}
+	return bom
+}
+
+func spdx(name string, b *BuildInfo, created time.Time) *spdxDocument {
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + sbomTool + "/" + strings.ReplaceAll(name, "@", "-") + "-" + uuid.NewString(),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomTool},
+		},
+	}
+
+	main := spdxPkg("SPDXRef-Package-main", b.Module, b.Version, b.Sum)
+	main.PrimaryPurpose = "APPLICATION"
+
+	toolchain := spdxPkg("SPDXRef-Package-std", "std", b.GoVersion, "")
+	doc.Packages = []*spdxPackage{main, toolchain}
+	doc.Relationships = []spdxRelationship{
+		{SPDXElementID: doc.SPDXID, RelationshipType: "DESCRIBES", RelatedSPDXElement: main.SPDXID},
+		{SPDXElementID: toolchain.SPDXID, RelationshipType: "BUILD_TOOL_OF", RelatedSPDXElement: main.SPDXID},
+	}
+
+	for n, d := range b.Deps {
+		p := spdxPkg(fmt.Sprintf("SPDXRef-Package-%d", n+1), d.Path, d.Version, d.Sum)
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{SPDXElementID: main.SPDXID, RelationshipType: "DEPENDS_ON", RelatedSPDXElement: p.SPDXID})
+	}
+	return doc
+}
+
+func spdxPkg(id, path, version, sum string) *spdxPackage {
+	p := &spdxPackage{
+		Name:             path,
+		SPDXID:           id,
+		VersionInfo:      version,
+		DownloadLocation: "NOASSERTION",
+		LicenseConcluded: "NOASSERTION",
+		LicenseDeclared:  "NOASSERTION",
+		CopyrightText:    "NOASSERTION",
+		ExternalRefs: []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  purl(path, version),
+		}},
+	}
+
+	if h := sumHex(sum); h != "" {
+		p.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: h}}
+	}
+	return p
+}
+
+func cdxHashes(sum string) []cdxHash {
+	if h := sumHex(sum); h != "" {
+		return []cdxHash{{Alg: "SHA-256", Content: h}}
+	}
+	return nil
+}
+
+// sumHex returns a go.sum h1 hash, a SHA-256 of the module tree, in hex
+func sumHex(sum string) string {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sum, "h1:"))
+	if err != nil || !strings.HasPrefix(sum, "h1:") || len(data) == 0 {
+		return ""
+	}
+	return hex.EncodeToString(data)
+}
+
+// purl returns the package URL of a module version
+func purl(path, version string) string {
+	p := "pkg:golang/" + path
+	if version != "" && version != "(devel)" {
+		p += "@" + version
+	}
+	return p
+}
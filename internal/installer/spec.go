@@ -0,0 +1,317 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/mod/module"
+	"strings"
+)
+
+// latestQuery is the version installed when a spec names none
+const latestQuery = "latest"
+
+var ErrInvalidSpec = errors.New("invalid tool spec")
+
+// valueFlags are the go build flags taking a value
+var valueFlags = map[string]bool{
+	"asmflags":      true,
+	"buildmode":     true,
+	"buildvcs":      true,
+	"compiler":      true,
+	"coverpkg":      true,
+	"covermode":     true,
+	"gccgoflags":    true,
+	"gcflags":       true,
+	"installsuffix": true,
+	"ldflags":       true,
+	"mod":           true,
+	"modfile":       true,
+	"overlay":       true,
+	"p":             true,
+	"pgo":           true,
+	"pkgdir":        true,
+	"tags":          true,
+	"toolexec":      true,
+}
+
+// boolFlags are the go build flags taking no value
+var boolFlags = map[string]bool{
+	"a":          true,
+	"asan":       true,
+	"cover":      true,
+	"linkshared": true,
+	"modcacherw": true,
+	"msan":       true,
+	"n":          true,
+	"race":       true,
+	"trimpath":   true,
+	"v":          true,
+	"work":       true,
+	"x":          true,
+}
+
+// ToolSpec is a tool to install: the package to build, the version query and
+// how to build it. Module is the module providing the package, it is resolved
+// at install time when empty
+type ToolSpec struct {
+	Module     string   `json:"module,omitempty" yaml:"module,omitempty"`
+	Package    string   `json:"package" yaml:"package"`
+	Version    string   `json:"version" yaml:"version"`
+	BuildFlags []string `json:"build_flags,omitempty" yaml:"buildFlags,omitempty"`
+	Env        []string `json:"env,omitempty" yaml:"env,omitempty"`
+	BinaryName string   `json:"binary_name,omitempty" yaml:"binaryName,omitempty"`
+}
+
+// ParseCommand parses a go install command line such as
+// CGO_ENABLED=0 go install -ldflags "-s -w" example.com/cmd/x@v1.2.0 -o x,
+// a version defaults to latest and a bare word names the binary
+func ParseCommand(command string) (*ToolSpec, error) {
+	args, err := splitArgs(command)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &ToolSpec{}
+	for len(args) > 0 && isEnvAssignment(args[0]) {
+		spec.Env = append(spec.Env, args[0])
+		args = args[1:]
+	}
+
+	if len(args) < 2 || args[0] != "go" || args[1] != "install" {
+		return nil, fmt.Errorf("%w: %q is not a go install command", ErrInvalidSpec, command)
+	}
+
+	var positional []string
+	for args = args[2:]; len(args) > 0; args = args[1:] {
+		arg := args[0]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch {
+		case name == "o":
+			if !hasValue {
+				if len(args) < 2 {
+					return nil, fmt.Errorf("%w: -o needs a binary name", ErrInvalidSpec)
+				}
+				args, value = args[1:], args[1]
+			}
+			spec.BinaryName = value
+		case valueFlags[name]:
+			if !hasValue {
+				if len(args) < 2 {
+					return nil, fmt.Errorf("%w: -%s needs a value", ErrInvalidSpec, name)
+				}
+				args, value = args[1:], args[1]
+			}
+			spec.BuildFlags = append(spec.BuildFlags, "-"+name+"="+value)
+		case boolFlags[name]:
+			spec.BuildFlags = append(spec.BuildFlags, "-"+name+valueSuffix(value, hasValue))
+		default:
+			return nil, fmt.Errorf("%w: unknown flag %s", ErrInvalidSpec, arg)
+		}
+	}
+
+	for _, arg := range positional {
+		switch {
+		case isPackage(arg):
+			if spec.Package != "" {
+				return nil, fmt.Errorf("%w: more than one package in %q", ErrInvalidSpec, command)
+			}
+			spec.Package, spec.Version, _ = strings.Cut(arg, "@")
+		case spec.BinaryName == "":
+			// legacy commands name the binary with a bare word
+			spec.BinaryName = arg
+		default:
+			return nil, fmt.Errorf("%w: unexpected argument %q", ErrInvalidSpec, arg)
+		}
+	}
+
+	if spec.Version == "" {
+		spec.Version = latestQuery
+	}
+	return spec, spec.Validate()
+}
+
+// Validate reports the first problem of the spec
+func (s *ToolSpec) Validate() error {
+	if s.Package == "" {
+		return fmt.Errorf("%w: no package", ErrInvalidSpec)
+	}
+
+	if err := module.CheckImportPath(s.Package); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSpec, err)
+	}
+
+	if s.Module != "" && s.Module != s.Package && !strings.HasPrefix(s.Package, s.Module+"/") {
+		return fmt.Errorf("%w: package %s is not in module %s", ErrInvalidSpec, s.Package, s.Module)
+	}
+
+	if s.Version == "" || strings.HasPrefix(s.Version, "-") || strings.ContainsAny(s.Version, "\n@") || (!isConstraint(s.Version) && strings.ContainsAny(s.Version, " \t")) {
+		return fmt.Errorf("%w: invalid version %q", ErrInvalidSpec, s.Version)
+	}
+
+	if s.BinaryName != "" && (strings.ContainsAny(s.BinaryName, `/\`) || s.BinaryName == "." || s.BinaryName == "..") {
+		return fmt.Errorf("%w: binary name %q must not be a path", ErrInvalidSpec, s.BinaryName)
+	}
+
+	for _, flag := range s.BuildFlags {
+		name, _, _ := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+		if !strings.HasPrefix(flag, "-") || (!valueFlags[name] && !boolFlags[name]) {
+			return fmt.Errorf("%w: unknown build flag %s", ErrInvalidSpec, flag)
+		}
+	}
+
+	for _, kv := range s.Env {
+		if !isEnvAssignment(kv) {
+			return fmt.Errorf("%w: env %q is not KEY=VALUE", ErrInvalidSpec, kv)
+		}
+	}
+	return nil
+}
+
+// Target is the argument of go install
+func (s *ToolSpec) Target() string {
+	return s.Package + "@" + s.Version
+}
+
+// Args returns the go command arguments installing the spec
+func (s *ToolSpec) Args() []string {
+	args := append([]string{"go", "install"}, s.BuildFlags...)
+	return append(args, s.Target())
+}
+
+// Binary returns the installed binary name, the last element of the package
+// path unless BinaryName is set
+func (s *ToolSpec) Binary() string {
+	if s.BinaryName != "" {
+		return s.BinaryName
+	}
+
+	prefix, pathMajor, ok := module.SplitPathVersion(s.Package)
+	if ok && pathMajor != "" {
+		// example.com/cmd/x/v2 installs x
+		return prefix[strings.LastIndex(prefix, "/")+1:]
+	}
+	return s.Package[strings.LastIndex(s.Package, "/")+1:]
+}
+
+// String returns the spec as a go install command line, ParseCommand reads it back
+func (s *ToolSpec) String() string {
+	var parts []string
+	for _, kv := range s.Env {
+		parts = append(parts, quoteArg(kv))
+	}
+
+	for _, arg := range s.Args() {
+		parts = append(parts, quoteArg(arg))
+	}
+
+	if s.BinaryName != "" {
+		parts = append(parts, "-o", quoteArg(s.BinaryName))
+	}
+	return strings.Join(parts, " ")
+}
+
+// splitArgs splits a command line like a POSIX shell: single quotes are
+// literal, double quotes and backslashes escape
+func splitArgs(command string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("%w: unterminated %c quote", ErrInvalidSpec, quote)
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("%w: trailing backslash", ErrInvalidSpec)
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// quoteArg single quotes an argument when the shell would split or expand it
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;#~!") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// isConstraint reports whether a version is a semver constraint such as ^1.2
+// or >=0.4, <0.5 rather than a query the go command understands
+func isConstraint(version string) bool {
+	return strings.ContainsAny(version, "^~<>=*|, ")
+}
+
+func isEnvAssignment(arg string) bool {
+	key, _, ok := strings.Cut(arg, "=")
+	if !ok || key == "" {
+		return false
+	}
+
+	for i, r := range key {
+		if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// isPackage reports whether a word is a package path, its first element is a
+// domain name
+func isPackage(arg string) bool {
+	path, _, _ := strings.Cut(arg, "@")
+	first, _, _ := strings.Cut(path, "/")
+	return strings.Contains(first, ".") || strings.Contains(arg, "@")
+}
+
+func valueSuffix(value string, hasValue bool) string {
+	if !hasValue {
+		return ""
+	}
+	return "=" + value
+}
@@ -0,0 +1,345 @@
+package installer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/shim"
+	"golang.org/x/mod/module"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	createTableLink = `CREATE TABLE IF NOT EXISTS tool_link (
+    binary TEXT PRIMARY KEY,
+    version TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+	createTableLinkHistory = `CREATE TABLE IF NOT EXISTS tool_link_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    binary TEXT NOT NULL,
+    previous TEXT NOT NULL,
+    version TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+	upsertLinkQuery            = `INSERT INTO tool_link (binary, version) VALUES (?, ?) ON CONFLICT(binary) DO UPDATE SET version = excluded.version, updated_at = CURRENT_TIMESTAMP`
+	selectLinkQuery            = `SELECT version FROM tool_link WHERE binary = ?`
+	selectLinksQuery           = `SELECT binary, version FROM tool_link`
+	deleteLinkQuery            = `DELETE FROM tool_link WHERE binary = ?`
+	insertLinkHistoryQuery     = `INSERT INTO tool_link_history (binary, previous, version) VALUES (?, ?, ?)`
+	selectLastLinkHistoryQuery = `SELECT id, previous FROM tool_link_history WHERE binary = ? ORDER BY id DESC LIMIT 1`
+	deleteLinkHistoryQuery     = `DELETE FROM tool_link_history WHERE id = ?`
+	deleteLinkVersionQuery     = `DELETE FROM tool_link_history WHERE binary = ? AND (previous = ? OR version = ?)`
+	deleteLinksHistoryQuery    = `DELETE FROM tool_link_history WHERE binary = ?`
+)
+
+var (
+	ErrNoHistory    = errors.New("nothing to roll back")
+	ErrNotInstalled = errors.New("tool version not installed")
+)
+
+// Use points the tool link in the bin directory at an installed version,
+// the version in use before is recorded for rollback
+func (i *Installer) Use(binary, version string) error {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+
+	in, err := i.installed(binary, version)
+	if err != nil {
+		return err
+	}
+	return i.activate(in)
+}
+
+// Rollback points the tool link back at the version used before the current
+// one and returns it, repeated calls walk further back
+func (i *Installer) Rollback(binary string) (string, error) {
+	var last struct {
+		ID       int    `db:"id"`
+		Previous string `db:"previous"`
+	}
+	if err := i.db.GetContext(i.ctx, &last, selectLastLinkHistoryQuery, binary); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", binary, ErrNoHistory)
+		}
+		return "", err
+	}
+
+	in, err := i.installed(binary, last.Previous)
+	if err != nil {
+		return "", err
+	}
+
+	if err = i.link(in); err != nil {
+		return "", err
+	}
+
+	tx, err := i.db.BeginTxx(i.ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = tx.ExecContext(i.ctx, upsertLinkQuery, binary, last.Previous); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if _, err = tx.ExecContext(i.ctx, deleteLinkHistoryQuery, last.ID); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+	return last.Previous, nil
+}
+
+// Active returns the version a tool link points at, empty when unset
+func (i *Installer) Active(binary string) (string, error) {
+	var version string
+	if err := i.db.GetContext(i.ctx, &version, selectLinkQuery, binary); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return version, nil
+}
+
+// Path returns where the binary of an install lives, the GOBIN of its module
+// version below the tools directory
+func (i *Installer) Path(in *Install) (string, error) {
+	dir, err := i.versionDir(in.modulePath(), in.Version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, exeName(in.Binary())), nil
+}
+
+// Current returns the install in use of every binary: the version its link
+// points at, else its newest install, in order of first install
+func (i *Installer) Current() ([]*Install, error) {
+	installs, err := i.Installs()
+	if err != nil {
+		return nil, err
+	}
+
+	var links []struct {
+		Binary  string `db:"binary"`
+		Version string `db:"version"`
+	}
+	if err = i.db.SelectContext(i.ctx, &links, selectLinksQuery); err != nil {
+		return nil, err
+	}
+
+	active := make(map[string]string, len(links))
+	for _, l := range links {
+		active[l.Binary] = l.Version
+	}
+
+	current := make(map[string]*Install)
+	var order []string
+	for _, in := range installs {
+		if in.Package == "" {
+			continue
+		}
+
+		binary := in.Binary()
+		prev, seen := current[binary]
+		if !seen {
+			order = append(order, binary)
+		}
+
+		// a newer install does not replace the linked version
+		if v, linked := active[binary]; !seen || !linked || in.Version == v || prev.Version != v {
+			current[binary] = in
+		}
+	}
+
+	list := make([]*Install, 0, len(order))
+	for _, binary := range order {
+		list = append(list, current[binary])
+	}
+	return list, nil
+}
+
+// installed returns the newest install of a tool version whose binary is on
+// disk
+func (i *Installer) installed(binary, version string) (*Install, error) {
+	installs, err := i.Installs()
+	if err != nil {
+		return nil, err
+	}
+
+	for j := len(installs) - 1; j >= 0; j-- {
+		in := installs[j]
+		if in.Package == "" || in.Binary() != binary || in.Version != version {
+			continue
+		}
+
+		path, err := i.Path(in)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = os.Stat(path); err == nil {
+			return in, nil
+		}
+	}
+	return nil, fmt.Errorf("%s@%s: %w", binary, version, ErrNotInstalled)
+}
+
+// activate links an install into the bin directory, records the move and
+// prunes the versions of the tool beyond the rollback window
+func (i *Installer) activate(in *Install) error {
+	binary := in.Binary()
+	previous, err := i.Active(binary)
+	if err != nil {
+		return err
+	}
+
+	if err = i.link(in); err != nil {
+		return err
+	}
+
+	if previous != in.Version {
+		tx, err := i.db.BeginTxx(i.ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(i.ctx, upsertLinkQuery, binary, in.Version); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if previous != "" {
+			if _, err = tx.ExecContext(i.ctx, insertLinkHistoryQuery, binary, previous, in.Version); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return i.prune(binary, in.Version)
+}
+
+// link atomically points the bin directory entry of a tool at the binary of
+// an install
+func (i *Installer) link(in *Install) error {
+	path, err := i.Path(in)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(i.binDir, 0o755); err != nil {
+		return err
+	}
+	return shim.Link(path, filepath.Join(i.binDir, exeName(in.Binary())))
+}
+
+// prune removes the versions of a tool beyond the active one and the keep
+// most recently installed others, with their records
+func (i *Installer) prune(binary, active string) error {
+	installs, err := i.Installs()
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{active: true}
+	for j, n := len(installs)-1, 0; j >= 0 && n < i.keep; j-- {
+		in := installs[j]
+		if in.Package != "" && in.Binary() == binary && !kept[in.Version] {
+			kept[in.Version] = true
+			n++
+		}
+	}
+
+	for _, in := range installs {
+		if in.Package == "" || in.Binary() != binary || kept[in.Version] {
+			continue
+		}
+
+		if err = i.remove(in); err != nil {
+			return err
+		}
+
+		if _, err = i.db.ExecContext(i.ctx, deleteLinkVersionQuery, binary, in.Version, in.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove deletes the binary and the records of an install, the version
+// directory goes once empty as other tools of the module may share it
+func (i *Installer) remove(in *Install) error {
+	path, err := i.Path(in)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for dir := filepath.Dir(path); dir != i.toolsDir && strings.HasPrefix(dir, i.toolsDir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	tx, err := i.db.BeginTxx(i.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = deleteBuild(i.ctx, tx, int64(in.ID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.ExecContext(i.ctx, deleteModules, in.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.ExecContext(i.ctx, deleteInstall, in.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// versionDir returns the GOBIN of a module version, laid out like the module
+// cache
+func (i *Installer) versionDir(modulePath, version string) (string, error) {
+	escapedPath, err := module.EscapePath(modulePath)
+	if err != nil {
+		return "", err
+	}
+
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(i.toolsDir, filepath.FromSlash(escapedPath)+"@"+escapedVersion), nil
+}
+
+// modulePath returns the module of an install, the package path of records
+// made before the module was stored
+func (in *Install) modulePath() string {
+	if in.Module != "" {
+		return in.Module
+	}
+	return in.Package
+}
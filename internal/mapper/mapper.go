@@ -8,6 +8,8 @@ import (
 	"github.com/inovacc/moonlight/internal/cron"
 	"github.com/inovacc/moonlight/pkg/versions"
 	"github.com/jmoiron/sqlx"
+	goversion "go/version"
+	"sort"
 	"time"
 )
 
@@ -30,6 +32,9 @@ const (
 	findByOSArchStableQuery     = `SELECT * FROM go_versions WHERE os = ? AND arch = ? AND stable = ?;`
 	findByOSArchKindStableQuery = `SELECT * FROM go_versions WHERE os = ? AND arch = ? AND kind = ? AND stable = ?;`
 	findBySha256Query           = `SELECT * FROM go_versions WHERE sha256 = ?;`
+	findByFilenameQuery         = `SELECT * FROM go_versions WHERE filename = ? LIMIT 1;`
+	findVersionsQuery           = `SELECT DISTINCT version, stable FROM go_versions;`
+	findFileQuery               = `SELECT * FROM go_versions WHERE version = ? AND os = ? AND arch = ? AND kind = ? LIMIT 1;`
 	insertQuery                 = `INSERT INTO go_versions (version, stable, filename, os, arch, sha256, size, kind) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
 	updateQuery                 = `UPDATE go_versions SET version = ?, stable = ?, filename = ?, os = ?, arch = ?, sha256 = ?, size = ?, kind = ? WHERE id = ?;`
 	deleteQuery                 = `DELETE FROM go_versions WHERE id = ?;`
@@ -42,7 +47,8 @@ const (
 type LatestVersion struct {
 	ID                  int    `json:"id,omitempty" db:"id"`
 	NexReleaseCandidate string `json:"next_release_candidate,omitempty" db:"next_release_candidate"`
-	StableVersion       string `json:"stable,omitempty" db:"stable"`
+	StableVersion       string `json:"stable,omitempty" db:"version"`
+	Stable              bool   `json:"-" db:"stable"`
 	Sha256              string `json:"sha256,omitempty" db:"sha256"`
 	CreatedAt           string `json:"created_at,omitempty" db:"created_at"`
 	UpdatedAt           string `json:"updated_at,omitempty" db:"updated_at"`
@@ -75,8 +81,9 @@ type File struct {
 }
 
 type MapVersions struct {
-	db  *sqlx.DB
-	ctx context.Context
+	db         *sqlx.DB
+	ctx        context.Context
+	newRelease string
 }
 
 func NewMapVersions(ctx context.Context, db *sqlx.DB, goVer *versions.GoVersion) (*MapVersions, error) {
@@ -93,6 +100,11 @@ func NewMapVersions(ctx context.Context, db *sqlx.DB, goVer *versions.GoVersion)
 		return nil, err
 	}
 
+	// without a fresh listing the catalog is only opened for queries
+	if goVer == nil {
+		return m, nil
+	}
+
 	if err := m.checkLatestVersion(goVer); err != nil {
 		return nil, err
 	}
@@ -198,22 +210,28 @@ func (m *MapVersions) checkLatestVersion(goVer *versions.GoVersion) error {
 		ReleaseCandidate: goVer.ReleaseCandidate,
 	}
 
-	customQuery := updateLatestQuery
-	if goVer.StableVersion != latestVersion.StableVersion {
-		customQuery = updateLatestQuery
+	if latestVersion.StableVersion == "" {
+		_, err := m.db.ExecContext(ctx, insertLatestQuery, uVer.StableVersion, true, uVer.ReleaseCandidate)
+		return err
 	}
 
-	if latestVersion.StableVersion == "" {
-		customQuery = insertLatestQuery
+	if goVer.StableVersion != latestVersion.StableVersion {
+		m.newRelease = goVer.StableVersion
 	}
 
-	if _, err := m.db.ExecContext(ctx, customQuery, uVer.StableVersion, true, uVer.ReleaseCandidate, uVer.ID); err != nil {
+	if _, err := m.db.ExecContext(ctx, updateLatestQuery, uVer.StableVersion, true, uVer.ReleaseCandidate, uVer.ID); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// NewRelease returns the stable release that landed since the previous sync,
+// empty when the latest version did not change
+func (m *MapVersions) NewRelease() string {
+	return m.newRelease
+}
+
 // GetAll returns all the versions
 func (m *MapVersions) GetAll() ([]*File, error) {
 	var v []*File
@@ -340,6 +358,37 @@ func (m *MapVersions) GetBySha256(sha256 string) (*File, error) {
 	return &v, nil
 }
 
+// GetByFilename returns a file by its name
+func (m *MapVersions) GetByFilename(filename string) (*File, error) {
+	var v File
+	if err := m.db.Get(&v, findByFilenameQuery, filename); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// GetVersions returns the distinct versions of the catalog, newest first
+func (m *MapVersions) GetVersions() ([]*Versions, error) {
+	var v []*Versions
+	if err := m.db.Select(&v, findVersionsQuery); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(v, func(i, j int) bool {
+		return goversion.Compare(v[i].Version, v[j].Version) > 0
+	})
+	return v, nil
+}
+
+// GetFile returns the file of a version for an OS, architecture, and kind
+func (m *MapVersions) GetFile(version, os, arch, kind string) (*File, error) {
+	var v File
+	if err := m.db.Get(&v, findFileQuery, version, os, arch, kind); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
 // GetLatest returns the latest version
 func (m *MapVersions) GetLatest() (*LatestVersion, error) {
 	var v LatestVersion
@@ -1,9 +1,13 @@
 package mapper
 
 import (
+	"context"
+	"fmt"
 	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/database/databasetest"
 	"github.com/inovacc/moonlight/pkg/versions"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -17,7 +21,7 @@ func TestNewMapVersions(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mapVerse, err := NewMapVersions(database.GetConnection(), goVer)
+	mapVerse, err := NewMapVersions(context.Background(), database.GetConnection(), goVer)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -103,3 +107,102 @@ func TestNewMapVersions(t *testing.T) {
 
 	assert.Equal(t, "go1.22.4", goVer.StableVersion)
 }
+
+func TestResolve(t *testing.T) {
+	databasetest.Open(t)
+
+	goVer := &versions.GoVersion{StableVersion: "go1.22.4"}
+	for _, v := range []string{"go1.23rc1", "go1.22.4", "go1.22.3", "go1.22.0", "go1.21.11", "go1.21.0", "go1.21rc2", "go1.20.14", "go1.20"} {
+		goVer.Versions = append(goVer.Versions, versions.Versions{
+			Version: v,
+			Stable:  !strings.Contains(v, "rc"),
+			Files:   []versions.File{{Filename: v + ".src.tar.gz", Os: "any", Arch: "any", Sha256: v, Kind: "source"}},
+		})
+	}
+
+	mapVerse, err := NewMapVersions(context.Background(), database.GetConnection(), goVer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"go1.21.0":  "go1.21.0",
+		"1.20":      "go1.20",
+		"1.21":      "go1.21.11",
+		"go1.22":    "go1.22.4",
+		"latest":    "go1.22.4",
+		"latest-1":  "go1.21.11",
+		"latest-2":  "go1.20.14",
+		">=1.21":    "go1.22.4",
+		"~1.21.0":   "go1.21.11",
+		"<1.22":     "go1.21.11",
+		"go1.23rc1": "go1.23rc1",
+	}
+
+	for spec, want := range cases {
+		got, err := mapVerse.Resolve(spec)
+		if err != nil {
+			t.Fatalf("Resolve(%q) error = %v", spec, err)
+		}
+		assert.Equal(t, want, got, spec)
+	}
+
+	_, err = mapVerse.Resolve("latest-5")
+	assert.Error(t, err)
+
+	matches, err := mapVerse.Match(">=1.21, <1.23", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"go1.22.4", "go1.22.3", "go1.22.0", "go1.21.11", "go1.21.0"}, matches)
+
+	matches, err = mapVerse.Match(">=1.23", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"go1.23rc1"}, matches)
+}
+
+func TestSupport(t *testing.T) {
+	databasetest.Open(t)
+
+	mapVerse, err := NewMapVersions(context.Background(), database.GetConnection(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = mapVerse.Support("go1.22.1")
+	assert.ErrorIs(t, err, ErrEmptyCatalog)
+
+	goVer := &versions.GoVersion{StableVersion: "go1.22.4"}
+	for _, v := range []string{"go1.23rc1", "go1.22.4", "go1.22.0", "go1.21.11", "go1.21.0", "go1.20.14"} {
+		goVer.Versions = append(goVer.Versions, versions.Versions{
+			Version: v,
+			Stable:  !strings.Contains(v, "rc"),
+			Files:   []versions.File{{Filename: v + ".src.tar.gz", Os: "any", Arch: "any", Sha256: v, Kind: "source"}},
+		})
+	}
+
+	if mapVerse, err = NewMapVersions(context.Background(), database.GetConnection(), goVer); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"go1.22.4":  "go1.22 true go1.22.4 true",
+		"go1.21.0":  "go1.21 true go1.21.11 false",
+		"go1.20.14": "go1.20 false go1.20.14 true",
+		"go1.23rc1": "go1.23 true  true",
+	}
+
+	for version, want := range cases {
+		s, err := mapVerse.Support(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, want, fmt.Sprintf("%s %v %s %v", s.Line, s.Supported, s.Latest, s.UpToDate()), version)
+		assert.Equal(t, []string{"go1.22", "go1.21"}, s.Lines)
+	}
+
+	_, err = mapVerse.Support("devel")
+	assert.ErrorIs(t, err, ErrInvalidVersion)
+}
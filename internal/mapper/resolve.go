@@ -0,0 +1,141 @@
+package mapper
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	goversion "go/version"
+	"strconv"
+	"strings"
+)
+
+const latestSpec = "latest"
+
+// Resolve turns a version spec into a release name of the catalog. Accepted
+// specs are exact releases (go1.21.9, 1.21.9), release lines (1.21) which
+// pick the newest patch, latest, latest-N for the Nth previous line and
+// semver constraints (>=1.21, ~1.22.1)
+func (m *MapVersions) Resolve(spec string) (string, error) {
+	all, err := m.GetVersions()
+	if err != nil {
+		return "", err
+	}
+
+	spec = strings.TrimSpace(spec)
+	name := "go" + strings.TrimPrefix(spec, "go")
+
+	for _, v := range all {
+		if v.Version == name {
+			return v.Version, nil
+		}
+	}
+
+	stable := make([]string, 0, len(all))
+	for _, v := range all {
+		if v.Stable {
+			stable = append(stable, v.Version)
+		}
+	}
+
+	switch {
+	case spec == latestSpec || spec == "stable":
+		return nth(stable, 0, spec)
+	case strings.HasPrefix(spec, latestSpec+"-"):
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, latestSpec+"-"))
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid version spec %q", spec)
+		}
+		return nth(stable, n, spec)
+	case goversion.IsValid(name) && goversion.Lang(name) == name:
+		for _, v := range stable {
+			if goversion.Lang(v) == name {
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("no stable release of %s in catalog", name)
+	}
+
+	matches, err := m.Match(spec, false)
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no release in catalog matches %q", spec)
+	}
+	return matches[0], nil
+}
+
+// Match returns the releases satisfying a semver constraint, newest first
+func (m *MapVersions) Match(constraint string, unstable bool) ([]string, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+	}
+
+	all, err := m.GetVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, v := range all {
+		if !v.Stable && !unstable {
+			continue
+		}
+
+		sv, err := Semver(v.Version)
+		if err != nil {
+			continue
+		}
+
+		// prereleases only match constraints that name one, so test
+		// release candidates against their final version
+		if unstable && sv.Prerelease() != "" {
+			final := *sv
+			if final, err = final.SetPrerelease(""); err != nil {
+				continue
+			}
+			sv = &final
+		}
+
+		if c.Check(sv) {
+			matches = append(matches, v.Version)
+		}
+	}
+	return matches, nil
+}
+
+// Semver converts a release name such as go1.21.3, go1.20 or go1.22rc1 to semver
+func Semver(version string) (*semver.Version, error) {
+	v := strings.TrimPrefix(version, "go")
+
+	// split a suffix like rc1 or beta2 into a prerelease
+	pre := ""
+	if i := strings.IndexAny(v, "abcdefghijklmnopqrstuvwxyz"); i >= 0 {
+		v, pre = v[:i], v[i:]
+	}
+
+	if strings.Count(v, ".") == 1 {
+		v += ".0"
+	}
+
+	if pre != "" {
+		v += "-" + pre
+	}
+	return semver.StrictNewVersion(v)
+}
+
+// nth returns the newest patch of the nth most recent release line
+func nth(stable []string, n int, spec string) (string, error) {
+	line := ""
+	for _, v := range stable {
+		if lang := goversion.Lang(v); lang != line {
+			line = lang
+			if n == 0 {
+				return v, nil
+			}
+			n--
+		}
+	}
+	return "", fmt.Errorf("no release in catalog for %q", spec)
+}
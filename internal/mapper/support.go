@@ -0,0 +1,70 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	goversion "go/version"
+)
+
+// supportedLines is how many release lines the Go project supports, a line
+// is maintained until two newer ones are released
+const supportedLines = 2
+
+var (
+	ErrEmptyCatalog   = errors.New("no stable release in catalog")
+	ErrInvalidVersion = errors.New("invalid go version")
+)
+
+// Support places a version in the release support window of the catalog.
+// Latest is the newest patch of its line, empty when the catalog does not
+// know the line yet
+type Support struct {
+	Version   string   `json:"version"`
+	Line      string   `json:"line"`
+	Supported bool     `json:"supported"`
+	Latest    string   `json:"latest,omitempty"`
+	Lines     []string `json:"supported_lines"`
+}
+
+// UpToDate reports whether the version is the newest patch of its line
+func (s *Support) UpToDate() bool {
+	return s.Latest == "" || goversion.Compare(s.Version, s.Latest) >= 0
+}
+
+// Support returns where a Go version such as go1.21.3 stands in the support
+// window
+func (m *MapVersions) Support(version string) (*Support, error) {
+	if !goversion.IsValid(version) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidVersion, version)
+	}
+
+	all, err := m.GetVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Support{Version: version, Line: goversion.Lang(version)}
+	newest := make(map[string]string)
+	for _, v := range all {
+		if !v.Stable {
+			continue
+		}
+
+		line := goversion.Lang(v.Version)
+		if _, ok := newest[line]; !ok {
+			newest[line] = v.Version
+			if len(s.Lines) < supportedLines {
+				s.Lines = append(s.Lines, line)
+			}
+		}
+	}
+
+	if len(s.Lines) == 0 {
+		return nil, ErrEmptyCatalog
+	}
+
+	// lines newer than the catalog, such as release candidates, are supported
+	s.Latest = newest[s.Line]
+	s.Supported = goversion.Compare(s.Line, s.Lines[len(s.Lines)-1]) >= 0
+	return s, nil
+}
@@ -0,0 +1,206 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	goversion "go/version"
+	"io"
+	"os/exec"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Result is the outcome of the command under one toolchain
+type Result struct {
+	Version  string        `json:"version"`
+	Passed   bool          `json:"passed"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Latest keeps the newest patch of every release line, versions must be newest first
+func Latest(versions []string) []string {
+	var out []string
+	seen := make(map[string]struct{})
+	for _, v := range versions {
+		line := goversion.Lang(v)
+		if _, ok := seen[line]; ok {
+			continue
+		}
+		seen[line] = struct{}{}
+		out = append(out, v)
+	}
+	return out
+}
+
+// Run executes argv under every toolchain with at most parallel runs at a
+// time, results keep the order of toolchains
+func Run(ctx context.Context, toolchains []*toolchain.Toolchain, argv []string, parallel int) []*Result {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]*Result, len(toolchains))
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i, t := range toolchains {
+		wg.Add(1)
+		go func(i int, t *toolchain.Toolchain) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = run(ctx, t, argv)
+		}(i, t)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func run(ctx context.Context, t *toolchain.Toolchain, argv []string) *Result {
+	r := &Result{
+		Version: t.Version,
+	}
+
+	cmd, err := t.Command(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		r.ExitCode = -1
+		r.Error = err.Error()
+		return r
+	}
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	start := time.Now()
+	err = cmd.Run()
+	r.Duration = time.Since(start)
+	r.Output = out.String()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		r.ExitCode = exitErr.ExitCode()
+		r.Error = err.Error()
+	case err != nil:
+		r.ExitCode = -1
+		r.Error = err.Error()
+	default:
+		r.Passed = true
+	}
+	return r
+}
+
+// Failed reports whether any run did not pass
+func Failed(results []*Result) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTable prints the aggregated pass/fail table
+func WriteTable(w io.Writer, results []*Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tRESULT\tEXIT\tDURATION")
+
+	for _, r := range results {
+		status := "pass"
+		if !r.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", r.Version, status, r.ExitCode, r.Duration.Round(time.Millisecond))
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the results as a JSON array
+func WriteJSON(w io.Writer, results []*Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results as a JUnit report, one test case per toolchain
+func WriteJUnit(w io.Writer, name string, results []*Result) error {
+	suite := junitSuite{
+		Name:  name,
+		Tests: len(results),
+	}
+
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration
+
+		c := junitCase{
+			Name:      r.Version,
+			ClassName: name,
+			Time:      seconds(r.Duration),
+		}
+
+		if r.Passed {
+			c.SystemOut = r.Output
+		} else {
+			suite.Failures++
+			c.Failure = &junitFailure{Message: r.Error, Text: r.Output}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
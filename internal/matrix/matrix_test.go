@@ -0,0 +1,83 @@
+//go:build !windows
+
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLatest(t *testing.T) {
+	versions := []string{"go1.22.4", "go1.22.3", "go1.21.11", "go1.21.0", "go1.20.14"}
+	assert.Equal(t, []string{"go1.22.4", "go1.21.11", "go1.20.14"}, Latest(versions))
+}
+
+func TestRun(t *testing.T) {
+	// the fake go fails on go1.20 only
+	toolchains := []*toolchain.Toolchain{
+		fakeToolchain(t, "go1.22.4", 0),
+		fakeToolchain(t, "go1.21.11", 0),
+		fakeToolchain(t, "go1.20.14", 1),
+	}
+
+	results := Run(context.Background(), toolchains, []string{"go", "test", "./..."}, 2)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	assert.True(t, results[0].Passed)
+	assert.Equal(t, "go1.22.4 test ./...\n", results[0].Output)
+	assert.True(t, results[1].Passed)
+	assert.False(t, results[2].Passed)
+	assert.Equal(t, 1, results[2].ExitCode)
+	assert.True(t, Failed(results))
+
+	var table bytes.Buffer
+	if err := WriteTable(&table, results); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, table.String(), "go1.20.14  FAIL")
+
+	var junit bytes.Buffer
+	if err := WriteJUnit(&junit, "moonlight.matrix", results); err != nil {
+		t.Fatal(err)
+	}
+
+	var report junitSuites
+	if err := xml.Unmarshal(junit.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, report.Suites[0].Tests)
+	assert.Equal(t, 1, report.Suites[0].Failures)
+	assert.NotNil(t, report.Suites[0].Cases[2].Failure)
+
+	var js bytes.Buffer
+	if err := WriteJSON(&js, results); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(js.String(), "["))
+}
+
+func fakeToolchain(t *testing.T, version string, code int) *toolchain.Toolchain {
+	t.Helper()
+
+	goroot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(goroot, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	script := "#!/bin/sh\necho " + version + " \"$@\"\nexit " + strconv.Itoa(code) + "\n"
+	if err := os.WriteFile(filepath.Join(goroot, "bin", "go"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	return &toolchain.Toolchain{Version: version, GoRoot: goroot}
+}
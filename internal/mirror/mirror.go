@@ -0,0 +1,188 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/downloader"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+)
+
+const (
+	ChannelStable   = "stable"
+	ChannelUnstable = "unstable"
+
+	sourceKind = "source"
+)
+
+// Report is the outcome of a sync, Missing lists the files that matched the
+// profile and are still not cached
+type Report struct {
+	Matched    int      `json:"matched"`
+	Cached     int      `json:"cached"`
+	Downloaded []string `json:"downloaded,omitempty"`
+	Missing    []string `json:"missing,omitempty"`
+}
+
+// Syncer pre-fetches the catalog files selected by the mirror profile
+type Syncer struct {
+	catalog *mapper.MapVersions
+	store   *artifact.Store
+	profile config.MirrorProfile
+	running atomic.Bool
+}
+
+func NewSyncer(catalog *mapper.MapVersions, store *artifact.Store, profile config.MirrorProfile) *Syncer {
+	return &Syncer{
+		catalog: catalog,
+		store:   store,
+		profile: profile,
+	}
+}
+
+// Plan returns the catalog files selected by the profile
+func (s *Syncer) Plan() ([]*mapper.File, error) {
+	versions, err := s.versions()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.catalog.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*mapper.File
+	for _, f := range files {
+		if versions[f.Version] && s.selects(f) {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// Status reports the selected files without downloading anything
+func (s *Syncer) Status() (*Report, error) {
+	return s.sync(false)
+}
+
+// Run downloads the selected files missing from the cache
+func (s *Syncer) Run() (*Report, error) {
+	return s.sync(true)
+}
+
+func (s *Syncer) sync(download bool) (*Report, error) {
+	files, err := s.Plan()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := s.store.Dir(artifact.Downloads)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Matched: len(files)}
+	var errs []error
+
+	for _, f := range files {
+		if s.store.Has(artifact.Downloads, f.Filename) {
+			report.Cached++
+			continue
+		}
+
+		if download {
+			if err = downloader.DownloadGoVersion(f.Filename, f.Sha256, dir); err == nil {
+				report.Downloaded = append(report.Downloaded, f.Filename)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", f.Filename, err))
+		}
+		report.Missing = append(report.Missing, f.Filename)
+	}
+	return report, errors.Join(errs...)
+}
+
+// versions returns the releases selected by the channels and the constraint
+func (s *Syncer) versions() (map[string]bool, error) {
+	channels := s.profile.Channels
+	if len(channels) == 0 {
+		channels = []string{ChannelStable}
+	}
+
+	for _, c := range channels {
+		if c != ChannelStable && c != ChannelUnstable {
+			return nil, fmt.Errorf("unknown mirror channel %q", c)
+		}
+	}
+
+	stable := slices.Contains(channels, ChannelStable)
+	unstable := slices.Contains(channels, ChannelUnstable)
+
+	constraint := s.profile.Versions
+	if constraint == "" {
+		constraint = "*"
+	}
+
+	matches, err := s.catalog.Match(constraint, unstable)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := s.catalog.GetVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool)
+	for _, v := range all {
+		if (v.Stable && stable) || (!v.Stable && unstable) {
+			selected[v.Version] = slices.Contains(matches, v.Version)
+		}
+	}
+	return selected, nil
+}
+
+// selects reports whether a file has a wanted kind and platform, sources
+// belong to every platform
+func (s *Syncer) selects(f *mapper.File) bool {
+	if len(s.profile.Kinds) > 0 && !slices.Contains(s.profile.Kinds, f.Kind) {
+		return false
+	}
+
+	if f.Kind == sourceKind || len(s.profile.Platforms) == 0 {
+		return true
+	}
+	return slices.Contains(s.profile.Platforms, f.Os+"/"+f.Arch)
+}
+
+// TryRun runs a sync and logs its report unless one is still downloading,
+// it reports whether it ran
+func (s *Syncer) TryRun() bool {
+	if !s.running.CompareAndSwap(false, true) {
+		slog.Info("mirror sync still running, skipped")
+		return false
+	}
+	defer s.running.Store(false)
+
+	report, err := s.Run()
+	if report != nil {
+		LogReport(report)
+	}
+	if err != nil {
+		slog.Error(err.Error())
+	}
+	return true
+}
+
+// LogReport logs the outcome of a scheduled sync
+func LogReport(r *Report) {
+	slog.Info("mirror sync", "matched", r.Matched, "cached", r.Cached, "downloaded", len(r.Downloaded), "missing", len(r.Missing))
+	for _, name := range r.Missing {
+		slog.Warn("mirror file missing", "file", name)
+	}
+}
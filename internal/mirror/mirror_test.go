@@ -0,0 +1,125 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/toolchain/toolchaintest"
+	"github.com/inovacc/moonlight/pkg/versions"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"testing"
+)
+
+func TestSyncer(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(path.Base(r.URL.Path)))
+	}))
+	defer upstream.Close()
+
+	saved := config.GetConfig.Mirror.Upstream
+	config.NewConfig(config.WithUpstream(upstream.URL))
+	t.Cleanup(func() { config.NewConfig(config.WithUpstream(saved)) })
+
+	catalog := newTestCatalog(t, "go1.23rc1", "go1.22.4", "go1.21.11", "go1.20.14")
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := config.MirrorProfile{
+		Enabled:   true,
+		Versions:  ">=1.21",
+		Platforms: []string{"linux/amd64", "darwin/arm64"},
+		Kinds:     []string{"archive", "source"},
+	}
+	syncer := NewSyncer(catalog, store, profile)
+
+	files, err := syncer.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Filename)
+	}
+	sort.Strings(names)
+
+	assert.Equal(t, []string{
+		"go1.21.11.darwin-arm64.tar.gz",
+		"go1.21.11.linux-amd64.tar.gz",
+		"go1.21.11.src.tar.gz",
+		"go1.22.4.darwin-arm64.tar.gz",
+		"go1.22.4.linux-amd64.tar.gz",
+		"go1.22.4.src.tar.gz",
+	}, names)
+
+	report, err := syncer.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, report.Missing, 6)
+	assert.Empty(t, report.Downloaded)
+
+	report, err = syncer.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, report.Downloaded, 6)
+	assert.Empty(t, report.Missing)
+
+	report, err = syncer.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 6, report.Cached)
+
+	// a scheduled sync does not overlap a running one
+	syncer.running.Store(true)
+	assert.False(t, syncer.TryRun())
+
+	syncer.running.Store(false)
+	assert.True(t, syncer.TryRun())
+
+	profile.Channels = []string{ChannelUnstable}
+	files, err = NewSyncer(catalog, store, profile).Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, files, 3)
+	assert.Equal(t, "go1.23rc1", files[0].Version)
+}
+
+// newTestCatalog lists a source, linux/amd64 and darwin/arm64 archives and a
+// windows installer for every release, the upstream serves each file name
+// as its content
+func newTestCatalog(t *testing.T, releases ...string) *mapper.MapVersions {
+	t.Helper()
+
+	file := func(name, goos, arch, kind string) versions.File {
+		return versions.File{Filename: name, Os: goos, Arch: arch, Sha256: fmt.Sprintf("%x", sha256.Sum256([]byte(name))), Size: len(name), Kind: kind}
+	}
+
+	goVer := &versions.GoVersion{StableVersion: releases[0]}
+	for _, v := range releases {
+		goVer.Versions = append(goVer.Versions, versions.Versions{
+			Version: v,
+			Stable:  v != "go1.23rc1",
+			Files: []versions.File{
+				file(v+".src.tar.gz", "any", "any", "source"),
+				file(v+".linux-amd64.tar.gz", "linux", "amd64", "archive"),
+				file(v+".darwin-arm64.tar.gz", "darwin", "arm64", "archive"),
+				file(v+".windows-amd64.msi", "windows", "amd64", "installer"),
+			},
+		})
+	}
+
+	return toolchaintest.NewCatalog(t, goVer)
+}
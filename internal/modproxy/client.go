@@ -0,0 +1,407 @@
+package modproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/config"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultGoProxy is the GOPROXY of the go command when none is set
+const defaultGoProxy = "https://proxy.golang.org,direct"
+
+var ErrProxyOff = errors.New("module lookup disabled by GOPROXY=off")
+
+// Info is the .info document of a module version
+type Info struct {
+	Version string    `json:"Version"`
+	Time    time.Time `json:"Time"`
+}
+
+// Resolved is a package query resolved to its module and version
+type Resolved struct {
+	Path      string    `json:"path"`
+	Version   string    `json:"version"`
+	Query     string    `json:"query"`
+	Time      time.Time `json:"time"`
+	Versions  []string  `json:"versions,omitempty"`
+	GoVersion string    `json:"go_version,omitempty"`
+}
+
+// Client queries modules over the GOPROXY protocol like the go command does:
+// proxies are tried in order, a comma moves to the next one only when a
+// module is not found and a pipe on any error. Modules matching noProxy, and
+// the direct entry, are resolved by the go command from version control
+type Client struct {
+	proxies []proxyEntry
+	noProxy string
+	http    *http.Client
+
+	// direct answers a GOPROXY request for direct mode
+	direct func(ctx context.Context, modulePath, file string) ([]byte, error)
+}
+
+// proxyEntry is an element of GOPROXY, fallback is set when a pipe follows it
+type proxyEntry struct {
+	url      string
+	fallback bool
+}
+
+// NewClient returns a client of a GOPROXY list, noProxy is a GONOPROXY style
+// pattern list
+func NewClient(goproxy, noProxy string) *Client {
+	return &Client{
+		proxies: parseGoProxy(goproxy),
+		noProxy: noProxy,
+		http:    &http.Client{Timeout: upstreamTimeout},
+		direct:  goDirect,
+	}
+}
+
+// NewClientFromEnv returns a client configured like the go command run by
+// the installer: proxy.goProxy, else GOPROXY, and GONOPROXY, else GOPRIVATE,
+// as go env reports them so the go env -w file counts too
+func NewClientFromEnv() *Client {
+	env := goEnv("GOPROXY", "GONOPROXY", "GOPRIVATE")
+
+	goproxy := config.GetConfig.Proxy.GoProxy
+	if goproxy == "" {
+		goproxy = env["GOPROXY"]
+	}
+
+	noProxy := env["GONOPROXY"]
+	if noProxy == "" {
+		noProxy = env["GOPRIVATE"]
+	}
+	return NewClient(goproxy, noProxy)
+}
+
+// goEnv returns the effective values of go environment variables, the
+// process environment when the go command cannot be run
+func goEnv(names ...string) map[string]string {
+	env := make(map[string]string)
+	out, err := exec.Command("go", append([]string{"env", "-json"}, names...)...).Output()
+	if err == nil {
+		err = json.Unmarshal(out, &env)
+	}
+
+	if err != nil {
+		for _, name := range names {
+			env[name] = os.Getenv(name)
+		}
+	}
+	return env
+}
+
+// Versions returns the tagged versions of a module, oldest first
+func (c *Client) Versions(ctx context.Context, modulePath string) ([]string, error) {
+	data, err := c.get(ctx, modulePath, "@v/"+listFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, v := range strings.Fields(string(data)) {
+		if semver.IsValid(v) {
+			versions = append(versions, v)
+		}
+	}
+	semver.Sort(versions)
+	return versions, nil
+}
+
+// Latest returns the newest release, else the newest pre-release, else the
+// version the proxy reports for @latest, usually a pseudo-version
+func (c *Client) Latest(ctx context.Context, modulePath string) (*Info, error) {
+	versions, err := c.Versions(ctx, modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if v := newest(versions, ""); v != "" {
+		return c.Info(ctx, modulePath, v)
+	}
+
+	data, err := c.get(ctx, modulePath, latestFile)
+	if err != nil {
+		return nil, err
+	}
+	return decodeInfo(data)
+}
+
+// Info resolves a query: latest, a version prefix such as v1.28, a version, a
+// branch or a commit
+func (c *Client) Info(ctx context.Context, modulePath, query string) (*Info, error) {
+	if query == "" || query == "latest" {
+		return c.Latest(ctx, modulePath)
+	}
+
+	// a prefix query selects the newest matching version
+	if semver.IsValid(query) && semver.Canonical(query) != query && !strings.ContainsAny(query, "-+") {
+		versions, err := c.Versions(ctx, modulePath)
+		if err != nil {
+			return nil, err
+		}
+
+		v := newest(versions, query)
+		if v == "" {
+			return nil, fmt.Errorf("%s@%s: no matching versions: %w", modulePath, query, ErrNotFound)
+		}
+		query = v
+	}
+
+	escaped, err := module.EscapeVersion(query)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.get(ctx, modulePath, "@v/"+escaped+".info")
+	if err != nil {
+		return nil, err
+	}
+	return decodeInfo(data)
+}
+
+// GoMod returns the go.mod of a module version
+func (c *Client) GoMod(ctx context.Context, modulePath, version string) ([]byte, error) {
+	escaped, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	return c.get(ctx, modulePath, "@v/"+escaped+".mod")
+}
+
+// Resolve finds the module providing a package by probing the package path
+// and its parents, longest first, and resolves the query in it
+func (c *Client) Resolve(ctx context.Context, pkg, query string) (*Resolved, error) {
+	if err := module.CheckImportPath(pkg); err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, candidate := range candidates(pkg) {
+		info, err := c.Info(ctx, candidate, query)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+
+		r := &Resolved{Path: candidate, Version: info.Version, Query: query, Time: info.Time}
+		if r.Versions, err = c.Versions(ctx, candidate); err != nil {
+			return nil, err
+		}
+
+		// the go directive is informative, a missing go.mod does not fail the query
+		if data, err := c.GoMod(ctx, candidate, info.Version); err == nil {
+			if f, err := modfile.ParseLax("go.mod", data, nil); err == nil && f.Go != nil {
+				r.GoVersion = f.Go.Version
+			}
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("no module provides package %s@%s: %w", pkg, query, lastErr)
+}
+
+// get answers a GOPROXY file of a module, walking the proxy list
+func (c *Client) get(ctx context.Context, modulePath, file string) ([]byte, error) {
+	if module.MatchPrefixPatterns(c.noProxy, modulePath) {
+		return c.direct(ctx, modulePath, file)
+	}
+
+	escaped, err := module.EscapePath(modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fmt.Errorf("%s: %w", modulePath, ErrNotFound)
+	for _, p := range c.proxies {
+		var data []byte
+		switch p.url {
+		case "off":
+			return nil, fmt.Errorf("%s: %w", modulePath, ErrProxyOff)
+		case "direct":
+			data, err = c.direct(ctx, modulePath, file)
+		default:
+			data, err = c.fetch(ctx, p.url+"/"+escaped+"/"+file)
+		}
+
+		if err == nil {
+			return data, nil
+		}
+
+		if !p.fallback && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound, http.StatusGone:
+		return nil, fmt.Errorf("%s: %w", url, ErrNotFound)
+	default:
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+}
+
+// goDirect answers a GOPROXY file from version control through the go
+// command, only modules outside every proxy pay for the process
+func goDirect(ctx context.Context, modulePath, file string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "moonlight-direct-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var args []string
+	switch {
+	case file == "@v/"+listFile:
+		args = []string{"list", "-m", "-json", "-versions", modulePath + "@latest"}
+	case file == latestFile:
+		args = []string{"list", "-m", "-json", modulePath + "@latest"}
+	case strings.HasSuffix(file, ".info"):
+		args = []string{"list", "-m", "-json", modulePath + "@" + strings.TrimSuffix(strings.TrimPrefix(file, "@v/"), ".info")}
+	case strings.HasSuffix(file, ".mod"):
+		args = []string{"mod", "download", "-json", modulePath + "@" + strings.TrimSuffix(strings.TrimPrefix(file, "@v/"), ".mod")}
+	default:
+		return nil, fmt.Errorf("%s: %w", file, errInvalidPath)
+	}
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOPROXY=direct", "GOFLAGS=-mod=mod")
+
+	out, err := cmd.Output()
+	if err != nil {
+		// the go command does not tell a missing module from a broken one
+		return nil, fmt.Errorf("%s %s: %w: %w", modulePath, file, ErrNotFound, err)
+	}
+
+	var m struct {
+		Version  string
+		Time     time.Time
+		Versions []string
+		GoMod    string
+	}
+	if err = json.Unmarshal(out, &m); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case file == "@v/"+listFile:
+		return []byte(strings.Join(m.Versions, "\n")), nil
+	case strings.HasSuffix(file, ".mod"):
+		return os.ReadFile(m.GoMod)
+	default:
+		return json.Marshal(&Info{Version: m.Version, Time: m.Time})
+	}
+}
+
+// parseGoProxy splits a GOPROXY list, off and direct stop the list
+func parseGoProxy(goproxy string) []proxyEntry {
+	if goproxy == "" {
+		goproxy = defaultGoProxy
+	}
+
+	var entries []proxyEntry
+	for goproxy != "" {
+		i := strings.IndexAny(goproxy, ",|")
+		element, sep := goproxy, byte(0)
+		if i >= 0 {
+			element, sep, goproxy = goproxy[:i], goproxy[i], goproxy[i+1:]
+		} else {
+			goproxy = ""
+		}
+
+		element = strings.TrimSpace(element)
+		if element == "" {
+			continue
+		}
+
+		entries = append(entries, proxyEntry{url: strings.TrimSuffix(element, "/"), fallback: sep == '|'})
+		if element == "off" || element == "direct" {
+			break
+		}
+	}
+	return entries
+}
+
+// candidates returns the module paths that may provide a package, longest
+// first, the first element is always a domain
+func candidates(pkg string) []string {
+	var list []string
+	for p := pkg; ; {
+		list = append(list, p)
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			return list
+		}
+		p = p[:i]
+	}
+}
+
+// newest returns the newest release matching a version prefix, else the
+// newest pre-release
+func newest(versions []string, prefix string) string {
+	matching := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if prefix == "" || v == prefix || strings.HasPrefix(v, prefix+".") || strings.HasPrefix(v, prefix+"-") {
+			matching = append(matching, v)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return semver.Compare(matching[i], matching[j]) > 0
+	})
+
+	for _, v := range matching {
+		if semver.Prerelease(v) == "" {
+			return v
+		}
+	}
+
+	if len(matching) > 0 {
+		return matching[0]
+	}
+	return ""
+}
+
+func decodeInfo(data []byte) (*Info, error) {
+	var i Info
+	if err := json.Unmarshal(data, &i); err != nil {
+		return nil, err
+	}
+
+	if !semver.IsValid(i.Version) {
+		return nil, fmt.Errorf("invalid version %q in module info", i.Version)
+	}
+	return &i, nil
+}
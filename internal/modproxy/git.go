@@ -0,0 +1,410 @@
+package modproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	modzip "golang.org/x/mod/zip"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// remoteHead is the default branch of the remote, used for @latest when
+	// no version is tagged
+	remoteHead = "refs/remotes/origin/HEAD"
+
+	gitTimeout = 5 * time.Minute
+)
+
+// GitRepo serves the modules under a path prefix from a git remote, module
+// zips are built from a local clone like the go command does in direct mode
+type GitRepo struct {
+	prefix string
+	url    string
+	dir    string
+
+	// mu serializes git commands on the clone
+	mu sync.Mutex
+}
+
+// NewGitRepo returns the repo of the modules under prefix, cloned from url
+// into the store on first use
+func NewGitRepo(store *artifact.Store, prefix, url string) (*GitRepo, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	escaped, err := module.EscapePath(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("repo prefix %q: %w", prefix, err)
+	}
+
+	dir, err := store.Path(artifact.Repos, escaped)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GitRepo{
+		prefix: prefix,
+		url:    url,
+		dir:    dir,
+	}, nil
+}
+
+// Matches reports whether modulePath lives in the repo
+func (g *GitRepo) Matches(modulePath string) bool {
+	return modulePath == g.prefix || strings.HasPrefix(modulePath, g.prefix+"/")
+}
+
+// fetch answers a GOPROXY request from the repo, list and @latest refresh the
+// clone first, versions missing from the clone refresh it once
+func (g *GitRepo) fetch(req *request) (io.ReadCloser, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	subdir, pathMajor, err := g.split(req.module)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.immutable() || !g.cloned() {
+		if err = g.sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case req.name == "@v/"+listFile:
+		versions, err := g.versions(subdir, pathMajor)
+		if err != nil {
+			return nil, err
+		}
+		return text(strings.Join(versions, "\n") + "\n"), nil
+	case req.name == latestFile:
+		return g.latest(req.module, subdir, pathMajor)
+	}
+
+	rev, version, err := g.revision(req, subdir, pathMajor)
+	if errors.Is(err, ErrNotFound) && req.immutable() {
+		// the version may have been pushed after the last sync
+		if err = g.sync(); err != nil {
+			return nil, err
+		}
+		rev, version, err = g.revision(req, subdir, pathMajor)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch path.Ext(req.name) {
+	case ".info":
+		return g.info(rev, version)
+	case ".mod":
+		data, err := g.goMod(req.module, subdir, rev)
+		if err != nil {
+			return nil, err
+		}
+		return text(string(data)), nil
+	default:
+		return g.zip(req.module, version, subdir, rev), nil
+	}
+}
+
+// split returns the subdirectory of a module and its major version suffix,
+// modules use the major branch convention so /v2 is not a directory
+func (g *GitRepo) split(modulePath string) (string, string, error) {
+	prefix, pathMajor, ok := module.SplitPathVersion(modulePath)
+	if !ok || strings.HasPrefix(pathMajor, ".") {
+		return "", "", fmt.Errorf("%s: %w", modulePath, errInvalidPath)
+	}
+
+	if prefix != g.prefix && !strings.HasPrefix(prefix, g.prefix+"/") {
+		return "", "", fmt.Errorf("%s: %w", modulePath, ErrNotFound)
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(prefix, g.prefix), "/"), pathMajor, nil
+}
+
+// versions returns the tagged versions of a module, oldest first
+func (g *GitRepo) versions(subdir, pathMajor string) ([]string, error) {
+	out, err := g.git("tag", "--list", tagPrefix(subdir)+"v*")
+	if err != nil {
+		return nil, err
+	}
+	return tagVersions(out, subdir, pathMajor), nil
+}
+
+// latest returns the newest release, else the newest pre-release, else a
+// pseudo-version of the default branch
+func (g *GitRepo) latest(modulePath, subdir, pathMajor string) (io.ReadCloser, error) {
+	versions, err := g.versions(subdir, pathMajor)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versions) > 0 {
+		version := versions[len(versions)-1]
+		for i := len(versions) - 1; i >= 0; i-- {
+			if semver.Prerelease(versions[i]) == "" {
+				version = versions[i]
+				break
+			}
+		}
+		return g.info("refs/tags/"+tagPrefix(subdir)+version, version)
+	}
+
+	rev, err := g.commit(remoteHead)
+	if err != nil {
+		return nil, fmt.Errorf("%s@latest: %w", modulePath, ErrNotFound)
+	}
+
+	version, err := g.pseudoVersion(rev, subdir, pathMajor)
+	if err != nil {
+		return nil, err
+	}
+	return g.info(rev, version)
+}
+
+// revision resolves the version of a request to a commit, queries such as a
+// branch name or a commit hash resolve to a tag or a pseudo-version
+func (g *GitRepo) revision(req *request, subdir, pathMajor string) (string, string, error) {
+	notFound := fmt.Errorf("%s@%s: %w", req.module, req.version, ErrNotFound)
+
+	if req.immutable() {
+		if err := module.CheckPathMajor(req.version, pathMajor); err != nil {
+			return "", "", notFound
+		}
+
+		if module.IsPseudoVersion(req.version) {
+			short, err := module.PseudoVersionRev(req.version)
+			if err != nil {
+				return "", "", notFound
+			}
+
+			rev, err := g.commit(short)
+			if err != nil || !strings.HasPrefix(rev, short) {
+				return "", "", notFound
+			}
+
+			// the timestamp is part of the version, a mismatch is a forged version
+			want, _ := module.PseudoVersionTime(req.version)
+			if t, err := g.commitTime(rev); err != nil || !t.Equal(want) {
+				return "", "", notFound
+			}
+			return rev, req.version, nil
+		}
+
+		rev, err := g.commit("refs/tags/" + tagPrefix(subdir) + req.version)
+		if err != nil {
+			return "", "", notFound
+		}
+		return rev, req.version, nil
+	}
+
+	rev, err := g.commit("refs/remotes/origin/" + req.version)
+	if err != nil {
+		if rev, err = g.commit(req.version); err != nil {
+			return "", "", notFound
+		}
+	}
+
+	// a tagged commit is known by its version
+	out, err := g.git("tag", "--points-at", rev, "--list", tagPrefix(subdir)+"v*")
+	if err != nil {
+		return "", "", err
+	}
+	if versions := tagVersions(out, subdir, pathMajor); len(versions) > 0 {
+		return rev, versions[len(versions)-1], nil
+	}
+
+	version, err := g.pseudoVersion(rev, subdir, pathMajor)
+	if err != nil {
+		return "", "", err
+	}
+	return rev, version, nil
+}
+
+// pseudoVersion names an untagged commit after the newest tag it contains
+func (g *GitRepo) pseudoVersion(rev, subdir, pathMajor string) (string, error) {
+	out, err := g.git("tag", "--merged", rev, "--list", tagPrefix(subdir)+"v*")
+	if err != nil {
+		return "", err
+	}
+
+	older := ""
+	if versions := tagVersions(out, subdir, pathMajor); len(versions) > 0 {
+		older = versions[len(versions)-1]
+	}
+
+	t, err := g.commitTime(rev)
+	if err != nil {
+		return "", err
+	}
+
+	major := strings.TrimPrefix(pathMajor, "/")
+	if older != "" {
+		major = semver.Major(older)
+	}
+	return module.PseudoVersion(major, older, t, rev[:12]), nil
+}
+
+func (g *GitRepo) info(rev, version string) (io.ReadCloser, error) {
+	t, err := g.commitTime(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(&Info{Version: version, Time: t})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// goMod returns the go.mod of a module at rev, synthesized when the module
+// has none
+func (g *GitRepo) goMod(modulePath, subdir, rev string) ([]byte, error) {
+	data, err := g.git("cat-file", "blob", rev+":"+path.Join(subdir, "go.mod"))
+	if err != nil {
+		return []byte(fmt.Sprintf("module %s\n", modfile.AutoQuote(modulePath))), nil
+	}
+
+	if declared := modfile.ModulePath(data); declared != modulePath {
+		return nil, fmt.Errorf("%s: go.mod declares module %q: %w", modulePath, declared, ErrNotFound)
+	}
+	return data, nil
+}
+
+// zip streams the module zip of rev, built with the same file rules as the
+// go command so its hash matches a zip built by go mod download
+func (g *GitRepo) zip(modulePath, version, subdir, rev string) io.ReadCloser {
+	if subdir != "" {
+		subdir += "/"
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		// the caller returns before reading, hold the clone until the zip is written
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		pw.CloseWithError(modzip.CreateFromVCS(pw, module.Version{Path: modulePath, Version: version}, g.dir, rev, subdir))
+	}()
+	return pr
+}
+
+func (g *GitRepo) cloned() bool {
+	info, err := os.Stat(filepath.Join(g.dir, ".git"))
+	return err == nil && info.IsDir()
+}
+
+// sync clones the remote or fetches its branches and tags, failures are
+// reported as upstream down so cached lists keep being served
+func (g *GitRepo) sync() error {
+	var err error
+	if g.cloned() {
+		_, err = g.git("fetch", "--prune", "--tags", "--force", "origin")
+		if err == nil {
+			_, err = g.git("remote", "set-head", "origin", "--auto")
+		}
+	} else {
+		if err = os.MkdirAll(filepath.Dir(g.dir), 0o755); err != nil {
+			return err
+		}
+		_ = os.RemoveAll(g.dir)
+		_, err = run(filepath.Dir(g.dir), "clone", "--no-checkout", "--", g.url, g.dir)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", errUpstreamDown, g.url, err)
+	}
+	return nil
+}
+
+func (g *GitRepo) commit(rev string) (string, error) {
+	out, err := g.git("rev-parse", "--verify", "--quiet", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g *GitRepo) commitTime(rev string) (time.Time, error) {
+	out, err := g.git("log", "-1", "--format=%ct", rev, "--")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+func (g *GitRepo) git(args ...string) ([]byte, error) {
+	return run(g.dir, args...)
+}
+
+// run runs git without prompting, credentials come from the ssh agent or the
+// credential helper
+func run(dir string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "LC_ALL=C")
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// tagPrefix is the tag prefix of the module in subdir
+func tagPrefix(subdir string) string {
+	if subdir == "" {
+		return ""
+	}
+	return subdir + "/"
+}
+
+// tagVersions returns the canonical versions of the major version among the
+// tags listed in out, sorted oldest first
+func tagVersions(out []byte, subdir, pathMajor string) []string {
+	var versions []string
+	for _, tag := range strings.Fields(string(out)) {
+		v, ok := strings.CutPrefix(tag, tagPrefix(subdir))
+		if !ok || semver.Canonical(v) != v || semver.Build(v) != "" {
+			continue
+		}
+
+		if module.IsPseudoVersion(v) || module.CheckPathMajor(v, pathMajor) != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.Compare(versions[i], versions[j]) < 0
+	})
+	return versions
+}
+
+func text(s string) io.ReadCloser {
+	return io.NopCloser(strings.NewReader(s))
+}
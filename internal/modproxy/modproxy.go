@@ -0,0 +1,326 @@
+package modproxy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"golang.org/x/mod/module"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pattern mounts the proxy at the server root so GOPROXY is the server URL,
+// more specific patterns such as /dl/ keep precedence
+const Pattern = "GET /"
+
+const (
+	latestFile = "@latest"
+	listFile   = "list"
+
+	upstreamTimeout = 2 * time.Minute
+)
+
+var (
+	ErrNotFound     = errors.New("not found upstream")
+	errInvalidPath  = errors.New("invalid module proxy path")
+	errUpstreamDown = errors.New("upstream unavailable")
+)
+
+// Proxy is a GOPROXY protocol server caching module data in the artifact
+// store. Version files never change and are served from cache, list and
+// @latest are refreshed from upstream and served from cache when it is down
+type Proxy struct {
+	store    *artifact.Store
+	upstream string
+	verifier Verifier
+	repos    []*GitRepo
+	client   *http.Client
+}
+
+// Verifier checks module files before they are cached
+type Verifier interface {
+	VerifyMod(path, version string, data []byte) error
+	VerifyZip(path, version, zipFile string) error
+}
+
+// request is a parsed GOPROXY request, name is the path below the module
+type request struct {
+	module  string
+	escaped string
+	name    string
+	version string
+}
+
+// NewProxy returns a proxy of upstream, verifier may be nil to cache module
+// files unchecked
+func NewProxy(store *artifact.Store, upstream string, verifier Verifier) *Proxy {
+	return &Proxy{
+		store:    store,
+		upstream: strings.TrimSuffix(upstream, "/"),
+		verifier: verifier,
+		client:   &http.Client{Timeout: upstreamTimeout},
+	}
+}
+
+// AddRepo serves the modules of a git repo instead of asking upstream, the
+// longest matching prefix wins
+func (p *Proxy) AddRepo(repo *GitRepo) {
+	p.repos = append(p.repos, repo)
+	sort.SliceStable(p.repos, func(i, j int) bool {
+		return len(p.repos[i].prefix) > len(p.repos[j].prefix)
+	})
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := parse(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType(req.name))
+
+	if !req.immutable() {
+		data, err := p.refreshed(req)
+		if err != nil {
+			p.error(w, req, err)
+			return
+		}
+		_, _ = w.Write(data)
+		return
+	}
+
+	f, err := p.cached(req)
+	if err != nil {
+		p.error(w, req, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// version files never change
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+func (p *Proxy) error(w http.ResponseWriter, req *request, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	slog.Error("module proxy", "module", req.module, "file", req.name, "error", err)
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+// cached opens an immutable file from the store, fetching it once
+func (p *Proxy) cached(req *request) (*os.File, error) {
+	if f, err := p.store.Open(artifact.Modules, req.key()); err == nil {
+		return f, nil
+	}
+
+	body, err := p.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	w, err := p.store.Create(artifact.Modules, req.key())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.Copy(w, body); err != nil {
+		w.Abort()
+		return nil, err
+	}
+
+	// a rogue upstream must not poison the cache
+	if err = p.verify(req, w.File); err != nil {
+		w.Abort()
+		return nil, err
+	}
+
+	if err = w.Commit(); err != nil {
+		return nil, err
+	}
+	return p.store.Open(artifact.Modules, req.key())
+}
+
+// verify checks a downloaded .mod or .zip, .info files carry no checksum and
+// private modules are unknown to the checksum database
+func (p *Proxy) verify(req *request, f *os.File) error {
+	if p.verifier == nil || p.repo(req.module) != nil {
+		return nil
+	}
+
+	switch path.Ext(req.name) {
+	case ".mod":
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		return p.verifier.VerifyMod(req.module, req.version, data)
+	case ".zip":
+		return p.verifier.VerifyZip(req.module, req.version, f.Name())
+	}
+	return nil
+}
+
+// refreshed asks upstream first and falls back to the cached copy when
+// upstream is down, a not found answer from upstream is authoritative
+func (p *Proxy) refreshed(req *request) ([]byte, error) {
+	body, err := p.fetch(req)
+	if err == nil {
+		defer body.Close()
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return data, p.save(req, data)
+	}
+
+	if !errors.Is(err, errUpstreamDown) {
+		return nil, err
+	}
+
+	cached, cerr := p.load(req)
+	if cerr != nil {
+		return nil, err
+	}
+
+	slog.Warn("module proxy upstream down, serving cached copy", "module", req.module, "file", req.name)
+	return cached, nil
+}
+
+// fetch returns the upstream body of a request, the caller closes it
+func (p *Proxy) fetch(req *request) (io.ReadCloser, error) {
+	if repo := p.repo(req.module); repo != nil {
+		return repo.fetch(req)
+	}
+
+	resp, err := p.client.Get(p.upstream + "/" + req.escaped + "/" + req.name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUpstreamDown, err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("%s %s: %w", req.module, req.name, ErrNotFound)
+	}
+	return nil, fmt.Errorf("%w: %s", errUpstreamDown, resp.Status)
+}
+
+// repo returns the git repo serving a module, nil for public modules
+func (p *Proxy) repo(modulePath string) *GitRepo {
+	for _, repo := range p.repos {
+		if repo.Matches(modulePath) {
+			return repo
+		}
+	}
+	return nil
+}
+
+func (p *Proxy) load(req *request) ([]byte, error) {
+	f, err := p.store.Open(artifact.Modules, req.key())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (p *Proxy) save(req *request, data []byte) error {
+	w, err := p.store.Create(artifact.Modules, req.key())
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Commit()
+}
+
+// parse splits /<escaped module>/@v/<file> and /<escaped module>/@latest
+func parse(urlPath string) (*request, error) {
+	urlPath = strings.TrimPrefix(urlPath, "/")
+
+	var escaped, name string
+	if i := strings.Index(urlPath, "/@v/"); i >= 0 {
+		escaped, name = urlPath[:i], urlPath[i+1:]
+	} else if prefix, ok := strings.CutSuffix(urlPath, "/"+latestFile); ok {
+		escaped, name = prefix, latestFile
+	} else {
+		return nil, errInvalidPath
+	}
+
+	modulePath, err := module.UnescapePath(escaped)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &request{module: modulePath, escaped: escaped, name: name}
+	if name == latestFile || name == "@v/"+listFile {
+		return req, nil
+	}
+
+	file := strings.TrimPrefix(name, "@v/")
+	ext := path.Ext(file)
+	switch ext {
+	case ".info", ".mod", ".zip":
+	default:
+		return nil, errInvalidPath
+	}
+
+	if req.version, err = module.UnescapeVersion(strings.TrimSuffix(file, ext)); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// immutable reports whether the file names a canonical version, queries such
+// as a branch name resolve differently over time
+func (r *request) immutable() bool {
+	return r.version != "" && module.CanonicalVersion(r.version) == r.version
+}
+
+// key is the store name, laid out like the GOPROXY URL
+func (r *request) key() string {
+	return r.escaped + "/" + r.name
+}
+
+func contentType(name string) string {
+	switch path.Ext(name) {
+	case ".info":
+		return "application/json"
+	case ".zip":
+		return "application/zip"
+	default:
+		if name == latestFile {
+			return "application/json"
+		}
+		return "text/plain; charset=utf-8"
+	}
+}
@@ -0,0 +1,505 @@
+package modproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	testModule  = "example.com/Hello"
+	testVersion = "v1.0.0"
+	testGoMod   = "module example.com/Hello\n\ngo 1.21\n"
+)
+
+func TestProxy(t *testing.T) {
+	upstream, hits := newUpstream(t)
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(NewProxy(store, upstream.URL, nil))
+	defer ts.Close()
+
+	// module paths are case-encoded on the wire
+	base := ts.URL + "/example.com/!hello"
+
+	status, body := get(t, base+"/@v/list")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, testVersion+"\n", body)
+
+	status, body = get(t, base+"/@v/"+testVersion+".mod")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, testGoMod, body)
+
+	// immutable files are fetched once
+	before := hits.Load()
+	for i := 0; i < 3; i++ {
+		status, _ = get(t, base+"/@v/"+testVersion+".info")
+		assert.Equal(t, http.StatusOK, status)
+	}
+	assert.Equal(t, before+1, hits.Load())
+
+	status, _ = get(t, base+"/@latest")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = get(t, base+"/@v/v9.9.9.info")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = get(t, ts.URL+"/../../etc/passwd")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// cached data outlives the upstream
+	upstream.Close()
+
+	status, body = get(t, base+"/@v/list")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, testVersion+"\n", body)
+
+	status, _ = get(t, base+"/@v/"+testVersion+".mod")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = get(t, base+"/@v/"+testVersion+".zip")
+	assert.Equal(t, http.StatusBadGateway, status)
+}
+
+func TestProxyVerify(t *testing.T) {
+	upstream, _ := newUpstream(t)
+	defer upstream.Close()
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(NewProxy(store, upstream.URL, rejectVerifier{}))
+	defer ts.Close()
+
+	base := ts.URL + "/example.com/!hello/@v/" + testVersion
+	for _, ext := range []string{".mod", ".zip"} {
+		status, _ := get(t, base+ext)
+		assert.Equal(t, http.StatusBadGateway, status, ext)
+
+		req, err := parse("/example.com/!hello/@v/" + testVersion + ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, store.Has(artifact.Modules, req.key()), ext)
+	}
+
+	// .info carries no checksum
+	status, _ := get(t, base+".info")
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestGitRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	remote := t.TempDir()
+	gitRun(t, remote, "init", "--quiet", "--initial-branch=main")
+	writeFiles(t, remote, map[string]string{
+		"go.mod":    "module corp.example/tools\n\ngo 1.21\n",
+		"LICENSE":   "internal use only\n",
+		"x/go.mod":  "module corp.example/tools/x\n\ngo 1.21\n",
+		"x/main.go": "package main\n\nfunc main() {}\n",
+	})
+	gitCommit(t, remote, "2024-01-02T03:04:05Z")
+	gitRun(t, remote, "tag", "v1.0.0")
+	gitRun(t, remote, "tag", "x/v0.1.0")
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewGitRepo(store, "corp.example/tools", remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// private modules are never sent to the checksum database
+	proxy := NewProxy(store, "http://127.0.0.1:0", rejectVerifier{})
+	proxy.AddRepo(repo)
+	ts := httptest.NewServer(proxy)
+	defer ts.Close()
+
+	base := ts.URL + "/corp.example/tools/x"
+
+	status, body := get(t, base+"/@v/list")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "v0.1.0\n", body)
+
+	// tags pushed later are picked up by the next list
+	writeFiles(t, remote, map[string]string{"x/main.go": "package main\n\nfunc main() { println() }\n"})
+	gitCommit(t, remote, "2024-02-03T04:05:06Z")
+	gitRun(t, remote, "tag", "x/v0.2.0")
+
+	status, body = get(t, base+"/@v/list")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "v0.1.0\nv0.2.0\n", body)
+
+	status, body = get(t, base+"/@latest")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"Version":"v0.2.0"`)
+
+	status, body = get(t, base+"/@v/v0.1.0.mod")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "module corp.example/tools/x\n\ngo 1.21\n", body)
+
+	status, body = get(t, base+"/@v/v0.1.0.zip")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "corp.example/tools/x@v0.1.0/main.go")
+	assert.Contains(t, body, "corp.example/tools/x@v0.1.0/LICENSE")
+
+	status, body = get(t, ts.URL+"/corp.example/tools/@v/list")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "v1.0.0\n", body)
+
+	// an untagged commit is served as a pseudo-version
+	writeFiles(t, remote, map[string]string{"x/extra.go": "package main\n"})
+	gitCommit(t, remote, "2024-03-04T05:06:07Z")
+
+	status, body = get(t, base+"/@v/main.info")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"Version":"v0.2.1-0.20240304050607-`)
+
+	pseudo := strings.TrimSuffix(strings.TrimPrefix(body, `{"Version":"`), `","Time":"2024-03-04T05:06:07Z"}`)
+	status, _ = get(t, base+"/@v/"+pseudo+".zip")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = get(t, base+"/@v/v0.9.0.info")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// a forged timestamp does not resolve
+	forged := "v0.2.1-0.20990101000000-" + pseudo[len(pseudo)-12:]
+	status, _ = get(t, base+"/@v/"+forged+".info")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return
+	}
+
+	cmd := exec.Command(goBin, "mod", "download", "-json", "corp.example/tools/x@latest")
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(),
+		"GOPROXY="+ts.URL,
+		"GONOSUMDB=corp.example",
+		"GOFLAGS=-modcacherw",
+		"GOMODCACHE="+t.TempDir(),
+		"GOTOOLCHAIN=local",
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	assert.Contains(t, string(out), `"Version": "v0.2.0"`)
+}
+
+func TestSumDBProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, "tree head")
+	}))
+	defer upstream.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle(SumDBPattern, NewSumDBProxy("sum.example.com", upstream.URL))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	status, _ := get(t, ts.URL+"/sumdb/sum.example.com/supported")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, body := get(t, ts.URL+"/sumdb/sum.example.com/latest")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "tree head", body)
+
+	status, _ = get(t, ts.URL+"/sumdb/sum.example.com/lookup/missing")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = get(t, ts.URL+"/sumdb/other.example.com/supported")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestClient(t *testing.T) {
+	upstream, _ := newUpstream(t)
+	defer upstream.Close()
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	ctx := context.Background()
+
+	// the module root is found by probing parents of the package
+	c := NewClient(missing.URL+","+upstream.URL, "")
+	r, err := c.Resolve(ctx, testModule+"/cmd/hello", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, testModule, r.Path)
+	assert.Equal(t, testVersion, r.Version)
+	assert.Equal(t, []string{testVersion}, r.Versions)
+	assert.Equal(t, "1.21", r.GoVersion)
+
+	info, err := c.Info(ctx, testModule, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, testVersion, info.Version)
+
+	_, err = c.Info(ctx, testModule, "v2")
+	assert.True(t, errors.Is(err, ErrNotFound), err)
+
+	_, err = c.Resolve(ctx, "example.com/Other/cmd/x", "latest")
+	assert.True(t, errors.Is(err, ErrNotFound), err)
+
+	// a comma falls through on not found only, a pipe on any error
+	_, err = NewClient(broken.URL+","+upstream.URL, "").Latest(ctx, testModule)
+	assert.Error(t, err)
+
+	_, err = NewClient(broken.URL+"|"+upstream.URL, "").Latest(ctx, testModule)
+	assert.NoError(t, err)
+
+	_, err = NewClient("off", "").Latest(ctx, testModule)
+	assert.True(t, errors.Is(err, ErrProxyOff), err)
+
+	// private modules skip the proxies
+	var direct []string
+	c = NewClient(upstream.URL, "example.com/*")
+	c.direct = func(ctx context.Context, modulePath, file string) ([]byte, error) {
+		direct = append(direct, modulePath+" "+file)
+		return nil, ErrNotFound
+	}
+	_, err = c.Versions(ctx, testModule)
+	assert.Error(t, err)
+	assert.Equal(t, []string{testModule + " @v/list"}, direct)
+}
+
+func TestClientFromEnv(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	upstream, hits := newUpstream(t)
+	defer upstream.Close()
+
+	// settings written with go env -w, not exported to the process
+	t.Setenv("GOENV", filepath.Join(t.TempDir(), "env"))
+	for _, name := range []string{"GOPROXY", "GONOPROXY", "GOPRIVATE"} {
+		t.Setenv(name, "")
+	}
+	if out, err := exec.Command("go", "env", "-w", "GOPROXY="+upstream.URL, "GOPRIVATE=example.com/*").CombinedOutput(); err != nil {
+		t.Fatalf("go env -w: %v\n%s", err, out)
+	}
+
+	c := NewClientFromEnv()
+	assert.Equal(t, []proxyEntry{{url: upstream.URL}}, c.proxies)
+
+	// a private module never reaches the proxy
+	var direct []string
+	c.direct = func(ctx context.Context, modulePath, file string) ([]byte, error) {
+		direct = append(direct, modulePath+" "+file)
+		return nil, ErrNotFound
+	}
+	_, err := c.Versions(context.Background(), testModule)
+	assert.Error(t, err)
+	assert.Equal(t, []string{testModule + " @v/list"}, direct)
+	assert.Zero(t, hits.Load())
+}
+
+func TestParseGoProxy(t *testing.T) {
+	assert.Equal(t, []proxyEntry{{url: "https://proxy.golang.org"}, {url: "direct"}}, parseGoProxy(""))
+	assert.Equal(t, []proxyEntry{
+		{url: "https://a.example", fallback: true},
+		{url: "https://b.example"},
+		{url: "off"},
+	}, parseGoProxy("https://a.example/|https://b.example,,off,https://never.example"))
+}
+
+func TestProxyGoCommand(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not available")
+	}
+
+	upstream, _ := newUpstream(t)
+	defer upstream.Close()
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(NewProxy(store, upstream.URL, nil))
+	defer ts.Close()
+
+	cmd := exec.Command(goBin, "mod", "download", "-json", testModule+"@"+testVersion)
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(),
+		"GOPROXY="+ts.URL,
+		"GOSUMDB=off",
+		"GOFLAGS=-modcacherw",
+		"GOMODCACHE="+t.TempDir(),
+		"GOTOOLCHAIN=local",
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	assert.Contains(t, string(out), `"Version": "v1.0.0"`)
+}
+
+func TestParse(t *testing.T) {
+	req, err := parse("/github.com/!burnt!sushi/toml/@v/v1.3.2.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "github.com/BurntSushi/toml", req.module)
+	assert.Equal(t, "v1.3.2", req.version)
+	assert.True(t, req.immutable())
+
+	req, err = parse("/github.com/spf13/cobra/@v/main.info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, req.immutable())
+
+	for _, bad := range []string{"/github.com/spf13/cobra", "/github.com/spf13/cobra/@v/v1.0.0.txt", "/../x/@v/list"} {
+		_, err = parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// newUpstream serves example.com/Hello v1.0.0 and counts the requests
+func newUpstream(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(testGoMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "hello.go"), []byte("package hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var zipData bytes.Buffer
+	if err := modzip.CreateFromDir(&zipData, module.Version{Path: testModule, Version: testVersion}, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	info := `{"Version":"v1.0.0","Time":"2024-01-02T03:04:05Z"}`
+	files := map[string]string{
+		"/example.com/!hello/@v/list":        testVersion + "\n",
+		"/example.com/!hello/@latest":        info,
+		"/example.com/!hello/@v/v1.0.0.info": info,
+		"/example.com/!hello/@v/v1.0.0.mod":  testGoMod,
+		"/example.com/!hello/@v/v1.0.0.zip":  zipData.String(),
+	}
+
+	hits := &atomic.Int64{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.Error(w, "not found: "+strings.TrimPrefix(r.URL.Path, "/"), http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, data)
+	}))
+	return ts, hits
+}
+
+// rejectVerifier plays a checksum database disagreeing with upstream
+type rejectVerifier struct{}
+
+func (rejectVerifier) VerifyMod(path, version string, data []byte) error {
+	return errors.New("checksum mismatch")
+}
+
+func (rejectVerifier) VerifyZip(path, version, zipFile string) error {
+	return errors.New("checksum mismatch")
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// gitCommit commits every change with a fixed date so pseudo-versions are stable
+func gitCommit(t *testing.T, dir, date string) {
+	t.Helper()
+
+	gitRun(t, dir, "add", "-A")
+	cmd := exec.Command("git", "commit", "--quiet", "-m", "change")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_AUTHOR_DATE="+date,
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com", "GIT_COMMITTER_DATE="+date,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+}
+
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
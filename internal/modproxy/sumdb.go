@@ -0,0 +1,64 @@
+package modproxy
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// SumDBPattern serves the checksum database proxy of the GOPROXY protocol
+const SumDBPattern = "GET /sumdb/"
+
+// SumDBProxy forwards /sumdb/<name>/ requests to the checksum database so
+// clients that cannot reach it directly verify modules through the proxy
+type SumDBProxy struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// NewSumDBProxy returns a proxy of the checksum database name served at url
+func NewSumDBProxy(name, url string) *SumDBProxy {
+	return &SumDBProxy{
+		name:   name,
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: upstreamTimeout},
+	}
+}
+
+func (s *SumDBProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/sumdb/"+s.name+"/")
+	if !ok || rest == "" || strings.Contains(rest, "..") {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the go command probes support before using the proxy for the database
+	if rest == "supported" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, s.url+"/"+rest, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		slog.Error("sumdb proxy", "path", rest, "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		slog.Debug("sumdb proxy", "path", rest, "error", err)
+	}
+}
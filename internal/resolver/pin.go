@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"fmt"
+	goversion "go/version"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Validate checks that v names a go release, e.g. go1.21.9 or 1.22rc1
+func Validate(v string) (string, error) {
+	n := Normalize(v)
+	if !goversion.IsValid(n) {
+		return "", fmt.Errorf("invalid go version %q", v)
+	}
+	return n, nil
+}
+
+// WriteLocal pins version in dir with a .go-version file and, when
+// toolVersions is set, the golang entry of an asdf .tool-versions file
+func WriteLocal(dir, version string, toolVersions bool) ([]string, error) {
+	version, err := Validate(version)
+	if err != nil {
+		return nil, err
+	}
+
+	// both files hold the bare number, as goenv and asdf expect
+	bare := strings.TrimPrefix(version, "go")
+
+	path := filepath.Join(dir, goVersionFile)
+	if err = os.WriteFile(path, []byte(bare+"\n"), 0o644); err != nil {
+		return nil, err
+	}
+
+	written := []string{path}
+	if !toolVersions {
+		return written, nil
+	}
+
+	path = filepath.Join(dir, toolVersionsFile)
+	if err = writeToolVersions(path, bare); err != nil {
+		return nil, err
+	}
+	return append(written, path), nil
+}
+
+// writeToolVersions sets the golang entry and keeps the other tools
+func writeToolVersions(path, version string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	entry := toolVersionsName + " " + version
+
+	var lines []string
+	found := false
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == toolVersionsName {
+			if !found {
+				lines = append(lines, entry)
+				found = true
+			}
+			continue
+		}
+
+		if line != "" || len(lines) > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	if !found {
+		lines = append(lines, entry)
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
@@ -0,0 +1,303 @@
+package resolver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/mod/modfile"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvVersion overrides every pin when set
+const EnvVersion = "MOONLIGHT_GO_VERSION"
+
+const (
+	goVersionFile    = ".go-version"
+	toolVersionsFile = ".tool-versions"
+	goModFile        = "go.mod"
+	goWorkFile       = "go.work"
+
+	// toolVersionsName is the asdf plugin name for go
+	toolVersionsName = "golang"
+)
+
+var ErrNoVersion = errors.New("no go version selected")
+
+type Source string
+
+const (
+	SourceEnv          Source = "env"
+	SourceGoVersion    Source = goVersionFile
+	SourceToolVersions Source = toolVersionsFile
+	SourceGoWork       Source = goWorkFile
+	SourceGoMod        Source = goModFile
+	SourceGlobal       Source = "global"
+)
+
+// Selection is the toolchain chosen for a directory and what chose it
+type Selection struct {
+	Version   string `json:"version"`
+	Source    Source `json:"source"`
+	Path      string `json:"path,omitempty"`
+	Directive string `json:"directive,omitempty"`
+}
+
+// Resolve selects the toolchain for dir, in order: MOONLIGHT_GO_VERSION,
+// nearest .go-version or .tool-versions, go.work then go.mod toolchain/go
+// directive, global default
+func Resolve(dir string, global func() (string, error)) (*Selection, error) {
+	return ResolveEnv(dir, os.Getenv, global)
+}
+
+// ResolveEnv is Resolve reading MOONLIGHT_GO_VERSION and GOWORK through
+// getenv, so callers can resolve a directory without their own environment
+func ResolveEnv(dir string, getenv func(string) string, global func() (string, error)) (*Selection, error) {
+	if v := getenv(EnvVersion); v != "" {
+		return &Selection{Version: Normalize(v), Source: SourceEnv}, nil
+	}
+
+	sel, err := findPin(dir)
+	if err != nil || sel != nil {
+		return sel, err
+	}
+
+	sel, err = findModule(dir, getenv)
+	if err != nil || sel != nil {
+		return sel, err
+	}
+
+	if global != nil {
+		v, err := global()
+		if err != nil {
+			return nil, err
+		}
+
+		if v != "" {
+			return &Selection{Version: Normalize(v), Source: SourceGlobal}, nil
+		}
+	}
+
+	return nil, ErrNoVersion
+}
+
+// String explains which file or variable chose the version
+func (s *Selection) String() string {
+	switch s.Source {
+	case SourceEnv:
+		return fmt.Sprintf("%s (set by %s)", s.Version, EnvVersion)
+	case SourceGlobal:
+		return fmt.Sprintf("%s (set by the global default)", s.Version)
+	case SourceGoWork, SourceGoMod:
+		return fmt.Sprintf("%s (set by the %s directive in %s)", s.Version, s.Directive, s.Path)
+	default:
+		return fmt.Sprintf("%s (set by %s)", s.Version, s.Path)
+	}
+}
+
+// findPin returns the nearest .go-version or .tool-versions pin, the first
+// one wins inside a directory
+func findPin(dir string) (*Selection, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		path := filepath.Join(dir, goVersionFile)
+		if isFile(path) {
+			v, err := readVersionFile(path)
+			if err != nil {
+				return nil, err
+			}
+			return &Selection{Version: v, Source: SourceGoVersion, Path: path}, nil
+		}
+
+		path = filepath.Join(dir, toolVersionsFile)
+		if isFile(path) {
+			v, err := readToolVersions(path)
+			if err != nil {
+				return nil, err
+			}
+
+			// a .tool-versions without a golang entry pins other tools only
+			if v != "" {
+				return &Selection{Version: v, Source: SourceToolVersions, Path: path, Directive: toolVersionsName}, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// findModule honors the workspace like the go command does: GOWORK, else the
+// nearest go.work, and falls back to the nearest go.mod
+func findModule(dir string, getenv func(string) string) (*Selection, error) {
+	workPath := ""
+	switch gowork := getenv("GOWORK"); gowork {
+	case "off":
+	case "":
+		workPath, _ = findUp(dir, goWorkFile)
+	default:
+		workPath = gowork
+	}
+
+	if workPath != "" {
+		v, directive, err := readGoWork(workPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if v != "" {
+			return &Selection{Version: v, Source: SourceGoWork, Path: workPath, Directive: directive}, nil
+		}
+	}
+
+	if path, ok := findUp(dir, goModFile); ok {
+		v, directive, err := readGoMod(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if v != "" {
+			return &Selection{Version: v, Source: SourceGoMod, Path: path, Directive: directive}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Normalize turns 1.21.9, go1.21.9 or a go directive like 1.21 into a release
+// name, alias names such as stable are returned as is
+func Normalize(v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return ""
+	}
+
+	bare := strings.TrimPrefix(v, "go")
+	if bare == "" || bare[0] < '0' || bare[0] > '9' {
+		return v
+	}
+	v = "go" + bare
+
+	// since go1.21 the first release of a line is go1.N.0
+	var major, minor int
+	if n, _ := fmt.Sscanf(v, "go%d.%d", &major, &minor); n == 2 && major == 1 && minor >= 21 {
+		if fmt.Sprintf("go%d.%d", major, minor) == v {
+			v += ".0"
+		}
+	}
+	return v
+}
+
+// findUp looks for name in dir and its parents
+func findUp(dir, name string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		path := filepath.Join(dir, name)
+		if isFile(path) {
+			return path, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// readVersionFile returns the first non comment line of a .go-version file
+func readVersionFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return Normalize(line), nil
+	}
+
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s: empty version file", path)
+}
+
+// readToolVersions returns the first version of the golang entry, empty when missing
+func readToolVersions(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == toolVersionsName {
+			return Normalize(fields[1]), nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// readGoMod returns the toolchain directive, falling back to the go directive
+func readGoMod(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	f, err := modfile.Parse(path, data, nil)
+	if err != nil {
+		return "", "", err
+	}
+	return pick(f.Toolchain, f.Go)
+}
+
+// readGoWork returns the toolchain directive, falling back to the go directive
+func readGoWork(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	f, err := modfile.ParseWork(path, data, nil)
+	if err != nil {
+		return "", "", err
+	}
+	return pick(f.Toolchain, f.Go)
+}
+
+func pick(toolchain *modfile.Toolchain, goLine *modfile.Go) (string, string, error) {
+	if toolchain != nil && toolchain.Name != "default" {
+		return Normalize(toolchain.Name), "toolchain", nil
+	}
+
+	if goLine != nil {
+		return Normalize(goLine.Version), "go", nil
+	}
+	return "", "", nil
+}
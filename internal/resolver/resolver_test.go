@@ -0,0 +1,155 @@
+package resolver
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "go1.21.9", Normalize("1.21.9"))
+	assert.Equal(t, "go1.21.9", Normalize("go1.21.9"))
+	assert.Equal(t, "go1.21.0", Normalize("1.21"))
+	assert.Equal(t, "go1.20", Normalize("1.20"))
+	assert.Equal(t, "go1.22rc1", Normalize("1.22rc1"))
+	assert.Equal(t, "", Normalize(" "))
+}
+
+func TestResolve(t *testing.T) {
+	t.Setenv(EnvVersion, "")
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+	project := filepath.Join(root, "project")
+	pkg := filepath.Join(project, "pkg")
+	if err := os.MkdirAll(pkg, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	global := func() (string, error) { return "1.20.14", nil }
+
+	sel, err := Resolve(pkg, global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.20.14", sel.Version)
+	assert.Equal(t, SourceGlobal, sel.Source)
+
+	writeFile(t, filepath.Join(project, "go.mod"), "module example.com/p\n\ngo 1.21\n")
+
+	sel, err = Resolve(pkg, global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.21.0", sel.Version)
+	assert.Equal(t, SourceGoMod, sel.Source)
+
+	writeFile(t, filepath.Join(project, "go.mod"), "module example.com/p\n\ngo 1.21\n\ntoolchain go1.22.4\n")
+
+	sel, err = Resolve(pkg, global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.22.4", sel.Version)
+
+	writeFile(t, filepath.Join(root, ".go-version"), "# pinned\n1.21.9\n")
+
+	sel, err = Resolve(pkg, global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.21.9", sel.Version)
+	assert.Equal(t, SourceGoVersion, sel.Source)
+	assert.Equal(t, filepath.Join(root, ".go-version"), sel.Path)
+
+	t.Setenv(EnvVersion, "go1.19.13")
+
+	sel, err = Resolve(pkg, global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.19.13", sel.Version)
+	assert.Equal(t, SourceEnv, sel.Source)
+}
+
+func TestResolveWorkspaceAndToolVersions(t *testing.T) {
+	t.Setenv(EnvVersion, "")
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+	mod := filepath.Join(root, "mod")
+	if err := os.MkdirAll(mod, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(mod, "go.mod"), "module example.com/mod\n\ngo 1.21.3\n")
+	writeFile(t, filepath.Join(root, "go.work"), "go 1.22.1\n\nuse ./mod\n")
+
+	sel, err := Resolve(mod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.22.1", sel.Version)
+	assert.Equal(t, SourceGoWork, sel.Source)
+	assert.Equal(t, "go1.22.1 (set by the go directive in "+filepath.Join(root, "go.work")+")", sel.String())
+
+	t.Setenv("GOWORK", "off")
+
+	sel, err = Resolve(mod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.21.3", sel.Version)
+	assert.Equal(t, SourceGoMod, sel.Source)
+
+	// a .tool-versions without golang does not pin go
+	writeFile(t, filepath.Join(mod, ".tool-versions"), "nodejs 20.11.0\n")
+
+	sel, err = Resolve(mod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, SourceGoMod, sel.Source)
+
+	written, err := WriteLocal(mod, "go1.21.9", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, written, 2)
+
+	data, err := os.ReadFile(filepath.Join(mod, ".tool-versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "nodejs 20.11.0\ngolang 1.21.9\n", string(data))
+
+	if err = os.Remove(filepath.Join(mod, ".go-version")); err != nil {
+		t.Fatal(err)
+	}
+
+	sel, err = Resolve(mod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.21.9", sel.Version)
+	assert.Equal(t, SourceToolVersions, sel.Source)
+
+	_, err = WriteLocal(mod, "latest", false)
+	assert.Error(t, err)
+}
+
+func TestResolveNoVersion(t *testing.T) {
+	t.Setenv(EnvVersion, "")
+	t.Setenv("GOWORK", "off")
+
+	_, err := Resolve(t.TempDir(), nil)
+	assert.ErrorIs(t, err, ErrNoVersion)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
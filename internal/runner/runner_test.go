@@ -0,0 +1,26 @@
+//go:build !windows
+
+package runner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os/exec"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	code, err := Run(exec.Command("sh", "-c", "exit 0"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+
+	code, err = Run(exec.Command("sh", "-c", "exit 3"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, code)
+
+	code, err = Run(exec.Command("sh", "-c", "kill -TERM $$"))
+	assert.NoError(t, err)
+	assert.Equal(t, 143, code)
+
+	_, err = Run(exec.Command("/nonexistent/binary"))
+	assert.Error(t, err)
+}
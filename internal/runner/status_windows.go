@@ -0,0 +1,9 @@
+//go:build windows
+
+package runner
+
+import "os"
+
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
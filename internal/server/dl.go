@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/mapper"
+	goversion "go/version"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ListPattern is the go.dev/dl listing endpoint
+const ListPattern = "GET /dl/{$}"
+
+const (
+	// sourceOS is how the catalog stores the empty os and arch of source files
+	sourceOS = "any"
+
+	listMaxAge = 5 * time.Minute
+)
+
+// Release is a go.dev/dl release, field order and tags match go.dev
+type Release struct {
+	Version string        `json:"version"`
+	Stable  bool          `json:"stable"`
+	Files   []ReleaseFile `json:"files"`
+}
+
+type ReleaseFile struct {
+	Filename string `json:"filename"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Version  string `json:"version"`
+	Sha256   string `json:"sha256"`
+	Size     int    `json:"size"`
+	Kind     string `json:"kind"`
+}
+
+// List serves /dl/?mode=json from the catalog in the go.dev format, by
+// default only the latest patch of the supported lines, every release with
+// include=all
+type List struct {
+	catalog *mapper.MapVersions
+}
+
+func NewList(catalog *mapper.MapVersions) *List {
+	return &List{
+		catalog: catalog,
+	}
+}
+
+func (l *List) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("mode") != "json" {
+		http.Error(w, "only mode=json is supported", http.StatusBadRequest)
+		return
+	}
+
+	releases, err := Releases(l.catalog, r.FormValue("include") == "all")
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "catalog unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", " ")
+	if err = enc.Encode(releases); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(listMaxAge.Seconds())))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256(buf.Bytes())))
+
+	// ServeContent answers If-None-Match with 304 and handles HEAD
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// Releases returns the catalog as go.dev lists it, newest first
+func Releases(catalog *mapper.MapVersions, all bool) ([]Release, error) {
+	files, err := catalog.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[string]*Release)
+	for _, f := range files {
+		rel, ok := byVersion[f.Version]
+		if !ok {
+			rel = &Release{Version: f.Version, Stable: f.Stable}
+			byVersion[f.Version] = rel
+		}
+
+		file := ReleaseFile{Filename: f.Filename, OS: f.Os, Arch: f.Arch, Version: f.Version, Sha256: f.Sha256, Size: f.Size, Kind: f.Kind}
+		if file.OS == sourceOS {
+			file.OS = ""
+		}
+		if file.Arch == sourceOS {
+			file.Arch = ""
+		}
+		rel.Files = append(rel.Files, file)
+	}
+
+	releases := make([]Release, 0, len(byVersion))
+	for _, rel := range byVersion {
+		sort.Slice(rel.Files, func(i, j int) bool {
+			a, b := rel.Files[i], rel.Files[j]
+			if a.OS != b.OS {
+				return a.OS < b.OS
+			}
+			if a.Arch != b.Arch {
+				return a.Arch < b.Arch
+			}
+			if a.Kind != b.Kind {
+				return a.Kind < b.Kind
+			}
+			return a.Filename < b.Filename
+		})
+		releases = append(releases, *rel)
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		return goversion.Compare(releases[i].Version, releases[j].Version) > 0
+	})
+
+	if all {
+		return releases, nil
+	}
+	return supported(catalog, releases)
+}
+
+// supported keeps the newest stable patch of the lines in the support window
+// of the catalog
+func supported(catalog *mapper.MapVersions, releases []Release) ([]Release, error) {
+	var out []Release
+	var lines []string
+
+	for _, rel := range releases {
+		if !rel.Stable {
+			continue
+		}
+
+		if lines == nil {
+			s, err := catalog.Support(rel.Version)
+			if err != nil {
+				return nil, err
+			}
+			lines = s.Lines
+		}
+
+		// releases and lines are both newest first
+		if goversion.Lang(rel.Version) == lines[len(out)] {
+			out = append(out, rel)
+			if len(out) == len(lines) {
+				break
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/downloader"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FilesPattern serves release files next to the listing
+const FilesPattern = "GET /dl/{file}"
+
+const (
+	sha256Suffix = ".sha256"
+
+	// release files never change once published
+	fileCacheControl = "public, max-age=31536000, immutable"
+)
+
+// Files serves release files of the catalog from the artifact store, with
+// range requests and .sha256 sidecars, downloading them from upstream on a
+// miss when pull-through is allowed
+type Files struct {
+	catalog     *mapper.MapVersions
+	store       *artifact.Store
+	pullThrough bool
+
+	mu      sync.Mutex
+	pending map[string]*sync.Mutex
+}
+
+func NewFiles(catalog *mapper.MapVersions, store *artifact.Store, pullThrough bool) *Files {
+	return &Files{
+		catalog:     catalog,
+		store:       store,
+		pullThrough: pullThrough,
+		pending:     make(map[string]*sync.Mutex),
+	}
+}
+
+func (f *Files) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("file")
+	sidecar := strings.HasSuffix(name, sha256Suffix)
+
+	file, err := f.catalog.GetByFilename(strings.TrimSuffix(name, sha256Suffix))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error(err.Error())
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := `"` + file.Sha256 + `"`
+	if sidecar {
+		etag = `"` + file.Sha256 + sha256Suffix + `"`
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fileCacheControl)
+
+	if sidecar {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeContent(w, r, name, time.Time{}, strings.NewReader(file.Sha256))
+		return
+	}
+
+	if err = f.ensure(file); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		slog.Error("pull-through failed", "file", file.Filename, "error", err)
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		return
+	}
+
+	content, err := f.store.Open(artifact.Downloads, file.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	info, err := content.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, file.Filename, info.ModTime(), content)
+}
+
+// ensure makes sure a file is cached, one download per file at a time
+func (f *Files) ensure(file *mapper.File) error {
+	if f.store.Has(artifact.Downloads, file.Filename) {
+		return nil
+	}
+
+	if !f.pullThrough {
+		return os.ErrNotExist
+	}
+
+	unlock := f.lock(file.Filename)
+	defer unlock()
+
+	// another request may have finished the download meanwhile
+	if f.store.Has(artifact.Downloads, file.Filename) {
+		return nil
+	}
+
+	dir, err := f.store.Dir(artifact.Downloads)
+	if err != nil {
+		return err
+	}
+	return downloader.DownloadGoVersion(file.Filename, file.Sha256, dir)
+}
+
+func (f *Files) lock(name string) func() {
+	f.mu.Lock()
+	l, ok := f.pending[name]
+	if !ok {
+		l = &sync.Mutex{}
+		f.pending[name] = l
+	}
+	f.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/toolchain/toolchaintest"
+	"github.com/inovacc/moonlight/pkg/versions"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testVersion = "go1.22.4"
+
+func TestToolchainModule(t *testing.T) {
+	catalog, store := newTestCatalog(t)
+
+	srv := NewServer("")
+	srv.Handle(ToolchainPattern, NewToolchainModule(catalog, store))
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	base := ts.URL + "/golang.org/toolchain/@v/"
+	modVersion := "v0.0.1-go1.22.4.linux-amd64"
+
+	// the darwin archive is in the catalog but not cached
+	status, body := get(t, base+"list")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, modVersion+"\n", string(body))
+
+	status, _ = get(t, base+"v0.0.1-go1.22.4.darwin-arm64.info")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body = get(t, base+modVersion+".mod")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "module golang.org/toolchain\n", string(body))
+
+	status, body = get(t, base+modVersion+".info")
+	assert.Equal(t, http.StatusOK, status)
+
+	var info moduleInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, modVersion, info.Version)
+	assert.Equal(t, time.Date(2024, 5, 30, 19, 26, 7, 0, time.UTC), info.Time)
+
+	status, body = get(t, base+modVersion+".zip")
+	assert.Equal(t, http.StatusOK, status)
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+
+	prefix := "golang.org/toolchain@" + modVersion + "/"
+	assert.ElementsMatch(t, []string{prefix + "VERSION", prefix + "bin/go", prefix + "bin/gofmt", prefix + "src/_go.mod"}, names)
+}
+
+func TestList(t *testing.T) {
+	release := func(version string, stable bool) versions.Versions {
+		return versions.Versions{
+			Version: version,
+			Stable:  stable,
+			Files: []versions.File{
+				{Filename: version + ".src.tar.gz", Os: "any", Arch: "any", Sha256: version + "src", Size: 1, Kind: "source"},
+				{Filename: version + ".linux-amd64.tar.gz", Os: "linux", Arch: "amd64", Sha256: version + "linux", Size: 2, Kind: archiveKind},
+			},
+		}
+	}
+
+	catalog := toolchaintest.NewCatalog(t, &versions.GoVersion{
+		StableVersion: "go1.22.4",
+		Versions: []versions.Versions{
+			release("go1.23rc1", false),
+			release("go1.22.4", true),
+			release("go1.22.3", true),
+			release("go1.21.11", true),
+			release("go1.20.14", true),
+		},
+	})
+
+	srv := NewServer("")
+	srv.Handle(ListPattern, NewList(catalog))
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/dl/?mode=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var releases []Release
+	if err = json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Cache-Control"), "max-age")
+	assert.Len(t, releases, 2)
+	assert.Equal(t, "go1.22.4", releases[0].Version)
+	assert.Equal(t, "go1.21.11", releases[1].Version)
+
+	// source files have no os or arch and come first, as on go.dev
+	src := releases[0].Files[0]
+	assert.Equal(t, "source", src.Kind)
+	assert.Empty(t, src.OS)
+	assert.Empty(t, src.Arch)
+
+	status, body := get(t, ts.URL+"/dl/?mode=json&include=all")
+	assert.Equal(t, http.StatusOK, status)
+
+	releases = nil
+	if err = json.Unmarshal(body, &releases); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, r := range releases {
+		names = append(names, r.Version)
+	}
+	assert.Equal(t, []string{"go1.23rc1", "go1.22.4", "go1.22.3", "go1.21.11", "go1.20.14"}, names)
+	assert.Contains(t, string(body), `"os": ""`)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/dl/?mode=json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+
+	cached, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached.Body.Close()
+	assert.Equal(t, http.StatusNotModified, cached.StatusCode)
+
+	status, _ = get(t, ts.URL+"/dl/")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestFiles(t *testing.T) {
+	catalog, store := newTestCatalog(t)
+
+	srv := NewServer("")
+	srv.Handle(FilesPattern, NewFiles(catalog, store, false))
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	linux := ts.URL + "/dl/" + testVersion + ".linux-amd64.tar.gz"
+	resp, err := http.Get(linux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	sum := fmt.Sprintf("%x", sha256.Sum256(body))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"`+sum+`"`, resp.Header.Get("ETag"))
+	assert.Equal(t, fmt.Sprint(len(body)), resp.Header.Get("Content-Length"))
+
+	status, sidecar := get(t, linux+".sha256")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, sum, string(sidecar))
+
+	req, err := http.NewRequest(http.MethodGet, linux, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=0-9")
+
+	partial, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk, _ := io.ReadAll(partial.Body)
+	partial.Body.Close()
+	assert.Equal(t, http.StatusPartialContent, partial.StatusCode)
+	assert.Equal(t, body[:10], chunk)
+
+	req.Header.Del("Range")
+	req.Header.Set("If-None-Match", `"`+sum+`"`)
+	cached, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached.Body.Close()
+	assert.Equal(t, http.StatusNotModified, cached.StatusCode)
+
+	// listed but not cached, and pull-through is off
+	status, _ = get(t, ts.URL+"/dl/"+testVersion+".darwin-arm64.tar.gz")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = get(t, ts.URL+"/dl/unknown.tar.gz")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestFilesPullThrough(t *testing.T) {
+	content := []byte("release archive")
+	filename := testVersion + ".darwin-arm64.tar.gz"
+
+	var hits int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path != "/"+filename {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer upstream.Close()
+
+	saved := config.GetConfig.Mirror.Upstream
+	config.NewConfig(config.WithUpstream(upstream.URL))
+	t.Cleanup(func() { config.NewConfig(config.WithUpstream(saved)) })
+
+	catalog := toolchaintest.NewCatalog(t, &versions.GoVersion{
+		StableVersion: testVersion,
+		Versions: []versions.Versions{{
+			Version: testVersion,
+			Stable:  true,
+			Files: []versions.File{
+				{Filename: filename, Os: "darwin", Arch: "arm64", Sha256: fmt.Sprintf("%x", sha256.Sum256(content)), Size: len(content), Kind: archiveKind},
+			},
+		}},
+	})
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewServer("")
+	srv.Handle(FilesPattern, NewFiles(catalog, store, true))
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		status, body := get(t, ts.URL+"/dl/"+filename)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, content, body)
+	}
+	assert.Equal(t, 1, hits)
+	assert.True(t, store.Has(artifact.Downloads, filename))
+}
+
+func get(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+// newTestCatalog returns a catalog listing linux and darwin archives, only
+// the linux one is cached in the store
+func newTestCatalog(t *testing.T) (*mapper.MapVersions, *artifact.Store) {
+	t.Helper()
+
+	store := toolchaintest.NewStore(t)
+	goVer := &versions.GoVersion{
+		StableVersion: testVersion,
+		Versions: []versions.Versions{{
+			Version: testVersion,
+			Stable:  true,
+			Files: []versions.File{
+				toolchaintest.Archive(t, store, testVersion, "linux", "amd64"),
+				{Filename: testVersion + ".darwin-arm64.tar.gz", Os: "darwin", Arch: "arm64", Sha256: "00", Size: 1, Kind: archiveKind},
+			},
+		}},
+	}
+
+	return toolchaintest.NewCatalog(t, goVer), store
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ToolchainPattern is where the golang.org/toolchain module is mounted,
+// GOPROXY must point at the server root
+const ToolchainPattern = "GET /" + toolchain.ModulePath + "/@v/"
+
+const archiveKind = "archive"
+
+// ToolchainModule serves the golang.org/toolchain module from the cached
+// release archives, so GOTOOLCHAIN switching works against the mirror
+type ToolchainModule struct {
+	catalog *mapper.MapVersions
+	store   *artifact.Store
+}
+
+type moduleInfo struct {
+	Version string    `json:"Version"`
+	Time    time.Time `json:"Time"`
+}
+
+func NewToolchainModule(catalog *mapper.MapVersions, store *artifact.Store) *ToolchainModule {
+	return &ToolchainModule{
+		catalog: catalog,
+		store:   store,
+	}
+}
+
+func (t *ToolchainModule) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	if name == "list" {
+		t.serveList(w)
+		return
+	}
+
+	ext := path.Ext(name)
+	modVersion := strings.TrimSuffix(name, ext)
+
+	file, err := t.archive(modVersion)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch ext {
+	case ".mod":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write(toolchain.ModuleFile())
+	case ".info":
+		t.serveInfo(w, file, modVersion)
+	case ".zip":
+		t.serveZip(w, r, file, modVersion)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveList lists the module versions whose archive is cached
+func (t *ToolchainModule) serveList(w http.ResponseWriter) {
+	files, err := t.catalog.GetByKind(archiveKind)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "catalog unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	var list []string
+	for _, f := range files {
+		if t.store.Has(artifact.Downloads, f.Filename) {
+			list = append(list, toolchain.ModuleVersion(f.Version, f.Os, f.Arch))
+		}
+	}
+	sort.Strings(list)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, v := range list {
+		_, _ = w.Write([]byte(v + "\n"))
+	}
+}
+
+func (t *ToolchainModule) serveInfo(w http.ResponseWriter, file *mapper.File, modVersion string) {
+	zipFile, err := t.moduleZip(file, modVersion)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "cannot build module zip", http.StatusInternalServerError)
+		return
+	}
+	defer zipFile.Close()
+
+	info, err := zipFile.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(moduleInfo{Version: modVersion, Time: info.ModTime().UTC()})
+}
+
+func (t *ToolchainModule) serveZip(w http.ResponseWriter, r *http.Request, file *mapper.File, modVersion string) {
+	zipFile, err := t.moduleZip(file, modVersion)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "cannot build module zip", http.StatusInternalServerError)
+		return
+	}
+	defer zipFile.Close()
+
+	info, err := zipFile.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeContent(w, r, modVersion+".zip", info.ModTime(), zipFile)
+}
+
+// archive returns the catalog entry of a module version when its archive is cached
+func (t *ToolchainModule) archive(modVersion string) (*mapper.File, error) {
+	version, goos, arch, err := toolchain.ParseModuleVersion(modVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := t.catalog.GetFile(version, goos, arch, archiveKind)
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.store.Has(artifact.Downloads, file.Filename) {
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
+
+// moduleZip opens the module zip, repackaging the release archive on first use,
+// the zip carries the release time as its modification time
+func (t *ToolchainModule) moduleZip(file *mapper.File, modVersion string) (*os.File, error) {
+	name := modVersion + ".zip"
+	if f, err := t.store.Open(artifact.Toolchains, name); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return f, err
+	}
+
+	archive, err := t.store.Path(artifact.Downloads, file.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	zw, err := t.store.Create(artifact.Toolchains, name)
+	if err != nil {
+		return nil, err
+	}
+
+	released, err := toolchain.WriteModuleZip(zw, archive, modVersion)
+	if err != nil {
+		zw.Abort()
+		return nil, err
+	}
+
+	if err = zw.Commit(); err != nil {
+		return nil, err
+	}
+
+	zipPath, err := t.store.Path(artifact.Toolchains, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !released.IsZero() {
+		if err = os.Chtimes(zipPath, released, released); err != nil {
+			return nil, err
+		}
+	}
+	return os.Open(zipPath)
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package shim
+
+import "syscall"
+
+// execTool replaces the shim process with the real binary
+func execTool(path string, argv, env []string) error {
+	return syscall.Exec(path, argv, env)
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package shim
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// execTool runs the real binary and exits with its status, windows has no exec
+func execTool(path string, argv, env []string) error {
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return err
+	}
+
+	os.Exit(0)
+	return nil
+}
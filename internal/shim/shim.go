@@ -0,0 +1,124 @@
+package shim
+
+import (
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Names are the toolchain binaries that get a shim
+var Names = []string{"go", "gofmt"}
+
+// Name returns the tool a shim was invoked as, empty when arg0 is not a shim
+func Name(arg0 string) string {
+	base := strings.TrimSuffix(filepath.Base(arg0), ".exe")
+	for _, name := range Names {
+		if base == name {
+			return name
+		}
+	}
+	return ""
+}
+
+// Generate creates one shim per tool in binDir pointing at the moonlight executable
+func Generate(binDir, exe string) error {
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		return err
+	}
+
+	for _, name := range Names {
+		target := filepath.Join(binDir, name)
+		if runtime.GOOS == "windows" {
+			target += ".exe"
+		}
+
+		if err := Link(exe, target); err != nil {
+			return fmt.Errorf("shim %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Resolve selects and installs, if needed, the toolchain for dir
+func Resolve(m *toolchain.Manager, dir string) (*toolchain.Toolchain, *resolver.Selection, error) {
+	sel, err := resolver.Resolve(dir, m.Global)
+	if err != nil {
+		if errors.Is(err, resolver.ErrNoVersion) {
+			return nil, nil, fmt.Errorf("%w: pin one with .go-version, go.mod or %s", err, resolver.EnvVersion)
+		}
+		return nil, nil, err
+	}
+
+	// pins may name an alias such as stable
+	version, err := m.Lookup(sel.Version)
+	if err != nil {
+		return nil, sel, err
+	}
+
+	t, err := m.Ensure(version)
+	if err != nil {
+		return nil, sel, err
+	}
+	return t, sel, nil
+}
+
+// Run resolves the toolchain for the working directory and runs the real tool
+func Run(m *toolchain.Manager, name string, args []string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	t, sel, err := Resolve(m, dir)
+	if err != nil {
+		return err
+	}
+
+	// usage only feeds gc, it never gets in the way of the tool
+	if sel.Path != "" {
+		dir = filepath.Dir(sel.Path)
+	}
+	if err = m.RecordUsage(t.Version, dir); err != nil {
+		slog.Debug("cannot record toolchain usage", "error", err)
+	}
+	return execTool(t.Bin(name), append([]string{name}, args...), t.Environ(os.Environ()))
+}
+
+// Link atomically replaces target with a symlink to exe, falling back to a copy
+func Link(exe, target string) error {
+	tmp := target + ".tmp"
+	_ = os.Remove(tmp)
+
+	if err := os.Symlink(exe, tmp); err != nil {
+		if err = copyFile(exe, tmp); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, target)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,45 @@
+package shim
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "go", Name("/home/gopher/.moonlight/bin/go"))
+	assert.Equal(t, "gofmt", Name("gofmt.exe"))
+	assert.Equal(t, "", Name("/usr/local/bin/moonlight"))
+	assert.Equal(t, "", Name("gopls"))
+}
+
+func TestGenerate(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "moonlight")
+	if err := os.WriteFile(exe, []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	binDir := filepath.Join(t.TempDir(), "bin")
+	if err := Generate(binDir, exe); err != nil {
+		t.Fatal(err)
+	}
+
+	// running it twice must replace the shims in place
+	if err := Generate(binDir, exe); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range Names {
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+
+		data, err := os.ReadFile(filepath.Join(binDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "binary", string(data))
+	}
+}
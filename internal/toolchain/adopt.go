@@ -0,0 +1,340 @@
+package toolchain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	goversion "go/version"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var ErrInstalled = errors.New("toolchain already installed")
+
+// tarballRoot is where the official installers put go
+var tarballRoot = "/usr/local/go"
+
+func init() {
+	if runtime.GOOS == "windows" {
+		tarballRoot = `C:\Program Files\Go`
+	}
+}
+
+// Candidate is a go installation found outside moonlight
+type Candidate struct {
+	Version string `json:"version"`
+	GoRoot  string `json:"goroot"`
+	Source  string `json:"source"`
+}
+
+// Adoption is a candidate checked against the release archive, Verified is
+// only set when a cached archive was available to compare with
+type Adoption struct {
+	Candidate
+	Verified bool    `json:"verified"`
+	Drift    []Drift `json:"drift,omitempty"`
+}
+
+// Discover looks for installs of the official tarball, gvm, goenv, asdf and
+// golang.org/dl wrappers, home is the user home directory
+func Discover(home string) ([]*Candidate, error) {
+	roots := []struct {
+		source string
+		glob   string
+	}{
+		{"tarball", tarballRoot},
+		{"gvm", filepath.Join(envOr("GVM_ROOT", filepath.Join(home, ".gvm")), "gos", "*")},
+		{"goenv", filepath.Join(envOr("GOENV_ROOT", filepath.Join(home, ".goenv")), "versions", "*")},
+		{"asdf", filepath.Join(envOr("ASDF_DATA_DIR", filepath.Join(home, ".asdf")), "installs", "golang", "*", "go")},
+		{"golang.org/dl", filepath.Join(home, "sdk", "go*")},
+	}
+
+	var out []*Candidate
+	seen := make(map[string]bool)
+
+	for _, root := range roots {
+		matches, err := filepath.Glob(root.glob)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dir := range matches {
+			real, err := filepath.EvalSymlinks(dir)
+			if err != nil || seen[real] {
+				continue
+			}
+
+			c, err := Inspect(dir, root.source)
+			if err != nil {
+				continue
+			}
+
+			seen[real] = true
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// Inspect reads the release of a GOROOT from its VERSION file
+func Inspect(goroot, source string) (*Candidate, error) {
+	goroot, err := filepath.Abs(goroot)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := ReadVersion(goroot)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isFile(filepath.Join(goroot, "bin", binName("go"))) {
+		return nil, fmt.Errorf("%s: no go binary", goroot)
+	}
+
+	return &Candidate{
+		Version: version,
+		GoRoot:  goroot,
+		Source:  source,
+	}, nil
+}
+
+// ReadVersion returns the release named by the first line of GOROOT/VERSION
+func ReadVersion(goroot string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(goroot, "VERSION"))
+	if err != nil {
+		return "", err
+	}
+
+	first, _, _ := strings.Cut(string(data), "\n")
+	version := strings.TrimSpace(first)
+	if !goversion.IsValid(version) {
+		return "", fmt.Errorf("%s: VERSION names no go release", goroot)
+	}
+	return version, nil
+}
+
+// Check compares a candidate with its release archive when it is cached,
+// so nothing is downloaded
+func (m *Manager) Check(c *Candidate) (*Adoption, error) {
+	a := &Adoption{Candidate: *c}
+
+	file, err := m.catalog.GetFile(c.Version, runtime.GOOS, runtime.GOARCH, archiveKind)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !m.store.Has(artifact.Downloads, file.Filename)) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := m.store.Path(artifact.Downloads, file.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if sum, err := hashFile(archive); err != nil || sum != file.Sha256 {
+		return a, err
+	}
+
+	if a.Drift, err = compareArchive(c.GoRoot, archive); err != nil {
+		return nil, err
+	}
+	a.Verified = len(a.Drift) == 0
+	return a, nil
+}
+
+// Adopt registers a checked install as a managed toolchain. By reference the
+// tree stays where it is and is never removed by moonlight, by copy it is
+// duplicated into the toolchains directory
+func (m *Manager) Adopt(a *Adoption, byCopy bool) (*Toolchain, error) {
+	if _, err := m.Get(a.Version); err == nil {
+		return nil, fmt.Errorf("%s: %w", a.Version, ErrInstalled)
+	} else if !errors.Is(err, ErrNotInstalled) {
+		return nil, err
+	}
+
+	goroot := a.GoRoot
+	if byCopy {
+		goroot = filepath.Join(m.dir, a.Version)
+		if err := m.copyTree(a.GoRoot, goroot); err != nil {
+			return nil, err
+		}
+	}
+
+	// the archive record allows repair once the archive is fetched
+	filename, sum := "", ""
+	if file, err := m.catalog.GetFile(a.Version, runtime.GOOS, runtime.GOARCH, archiveKind); err == nil {
+		filename, sum = file.Filename, file.Sha256
+	}
+
+	if _, err := m.db.ExecContext(m.ctx, insertQuery, a.Version, goroot, filename, sum); err != nil {
+		return nil, err
+	}
+
+	if err := m.recordTree(a.Version, goroot); err != nil {
+		return nil, err
+	}
+	return m.Get(a.Version)
+}
+
+// owns reports whether the tree of a toolchain was created by moonlight
+func (m *Manager) owns(t *Toolchain) bool {
+	rel, err := filepath.Rel(m.dir, t.GoRoot)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// recordTree replaces the manifest of a toolchain with the files of its tree
+func (m *Manager) recordTree(version, goroot string) error {
+	var files []ManifestFile
+	err := filepath.WalkDir(goroot, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(goroot, name)
+		if err != nil {
+			return err
+		}
+
+		sum, err := hashFile(name)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, ManifestFile{Path: filepath.ToSlash(rel), Mode: uint32(info.Mode().Perm()), Sha256: sum})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return m.saveManifest(version, files)
+}
+
+// copyTree copies an install into a temporary sibling and renames it into place
+func (m *Manager) copyTree(src, dest string) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(m.dir, ".adopt-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	err = filepath.WalkDir(src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(tmp, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return writeFile(target, f, info.Mode())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = os.RemoveAll(dest); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// compareArchive hashes a tree against the content of a release archive,
+// modes are ignored since other managers extract with their own
+func compareArchive(goroot, archive string) ([]Drift, error) {
+	files, err := archiveFiles(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string]string, len(files))
+	for _, f := range files {
+		expected[f.Path] = f.Sha256
+	}
+
+	var drift []Drift
+	for name, want := range expected {
+		sum, err := hashFile(filepath.Join(goroot, filepath.FromSlash(name)))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			drift = append(drift, Drift{Path: name, Kind: DriftMissing})
+		case err != nil:
+			return nil, err
+		case sum != want:
+			drift = append(drift, Drift{Path: name, Kind: DriftModified})
+		}
+	}
+
+	err = filepath.WalkDir(goroot, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(goroot, name)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := expected[filepath.ToSlash(rel)]; !ok {
+			drift = append(drift, Drift{Path: filepath.ToSlash(rel), Kind: DriftAdded})
+		}
+		return nil
+	})
+	return drift, err
+}
+
+func binName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,176 @@
+package toolchain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	goversion "go/version"
+)
+
+// GlobalAlias names the user default toolchain
+const GlobalAlias = "global"
+
+const (
+	createTableAlias = `CREATE TABLE IF NOT EXISTS toolchain_alias (
+    name TEXT PRIMARY KEY,
+    version TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+	createTableAliasHistory = `CREATE TABLE IF NOT EXISTS toolchain_alias_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    previous TEXT NOT NULL,
+    version TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+	upsertAliasQuery       = `INSERT INTO toolchain_alias (name, version) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET version = excluded.version, updated_at = CURRENT_TIMESTAMP`
+	selectAliasQuery       = `SELECT version FROM toolchain_alias WHERE name = ?`
+	selectAliasesQuery     = `SELECT name, version FROM toolchain_alias ORDER BY name`
+	insertHistoryQuery     = `INSERT INTO toolchain_alias_history (name, previous, version) VALUES (?, ?, ?)`
+	selectLastHistoryQuery = `SELECT * FROM toolchain_alias_history WHERE name = ? ORDER BY id DESC LIMIT 1`
+	selectHistoryQuery     = `SELECT * FROM toolchain_alias_history WHERE name = ? ORDER BY id DESC`
+	deleteHistoryQuery     = `DELETE FROM toolchain_alias_history WHERE id = ?`
+)
+
+var ErrNoHistory = errors.New("nothing to roll back")
+
+type Alias struct {
+	Name    string `json:"name" db:"name"`
+	Version string `json:"version" db:"version"`
+}
+
+// AliasChange is one move of an alias, kept for rollback
+type AliasChange struct {
+	ID        int    `json:"id,omitempty" db:"id"`
+	Name      string `json:"name,omitempty" db:"name"`
+	Previous  string `json:"previous,omitempty" db:"previous"`
+	Version   string `json:"version,omitempty" db:"version"`
+	CreatedAt string `json:"created_at,omitempty" db:"created_at"`
+}
+
+// SetAlias points an alias such as the global default at a version,
+// the previous target is recorded for rollback
+func (m *Manager) SetAlias(name, version string) error {
+	previous, err := m.GetAlias(name)
+	if err != nil {
+		return err
+	}
+
+	if previous == version {
+		return nil
+	}
+
+	tx, err := m.db.BeginTxx(m.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(m.ctx, upsertAliasQuery, name, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if previous != "" {
+		if _, err = tx.ExecContext(m.ctx, insertHistoryQuery, name, previous, version); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetAlias returns the version behind an alias, empty when unset
+func (m *Manager) GetAlias(name string) (string, error) {
+	var version string
+	if err := m.db.GetContext(m.ctx, &version, selectAliasQuery, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return version, nil
+}
+
+// Aliases returns every alias
+func (m *Manager) Aliases() ([]*Alias, error) {
+	var a []*Alias
+	if err := m.db.SelectContext(m.ctx, &a, selectAliasesQuery); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// History returns the moves of an alias, most recent first
+func (m *Manager) History(name string) ([]*AliasChange, error) {
+	var h []*AliasChange
+	if err := m.db.SelectContext(m.ctx, &h, selectHistoryQuery, name); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Rollback moves an alias back to its previous version and returns it,
+// repeated calls walk further back
+func (m *Manager) Rollback(name string) (string, error) {
+	var last AliasChange
+	if err := m.db.GetContext(m.ctx, &last, selectLastHistoryQuery, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", name, ErrNoHistory)
+		}
+		return "", err
+	}
+
+	tx, err := m.db.BeginTxx(m.ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = tx.ExecContext(m.ctx, upsertAliasQuery, name, last.Previous); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if _, err = tx.ExecContext(m.ctx, deleteHistoryQuery, last.ID); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+	return last.Previous, nil
+}
+
+// Global returns the user default version
+func (m *Manager) Global() (string, error) {
+	return m.lookup(GlobalAlias)
+}
+
+// Lookup returns version itself when it names a release, otherwise the
+// version behind the alias of that name
+func (m *Manager) Lookup(version string) (string, error) {
+	if goversion.IsValid(version) {
+		return version, nil
+	}
+
+	target, err := m.GetAlias(version)
+	if err != nil {
+		return "", err
+	}
+
+	if target == "" {
+		return "", fmt.Errorf("%q is neither a go release nor an alias", version)
+	}
+	return target, nil
+}
+
+// lookup follows an alias that may itself name another alias, e.g. global=stable
+func (m *Manager) lookup(name string) (string, error) {
+	version, err := m.GetAlias(name)
+	if err != nil || version == "" || goversion.IsValid(version) {
+		return version, err
+	}
+	return m.Lookup(version)
+}
@@ -0,0 +1,151 @@
+package toolchain
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archivePrefix is the top level directory of every go release archive
+const archivePrefix = "go/"
+
+// walkFunc is called for every entry of a release archive, r is nil for directories
+type walkFunc func(name string, info fs.FileInfo, r io.Reader) error
+
+// extract unpacks a release archive into dest, dropping the leading go/ directory
+func extract(archive, dest string) error {
+	return walk(archive, func(name string, info fs.FileInfo, r io.Reader) error {
+		target, ok, err := targetPath(dest, name)
+		if err != nil || !ok {
+			return err
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		return writeFile(target, r, info.Mode())
+	})
+}
+
+// walk calls fn for the directories and regular files of a .tar.gz or .zip archive
+func walk(archive string, fn walkFunc) error {
+	switch {
+	case strings.HasSuffix(archive, ".tar.gz"):
+		return walkTarGz(archive, fn)
+	case strings.HasSuffix(archive, ".zip"):
+		return walkZip(archive, fn)
+	default:
+		return fmt.Errorf("unsupported archive %s", filepath.Base(archive))
+	}
+}
+
+func walkTarGz(archive string, fn walkFunc) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = fn(hdr.Name, hdr.FileInfo(), nil)
+		case tar.TypeReg:
+			err = fn(hdr.Name, hdr.FileInfo(), tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(archive string, fn walkFunc) error {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, file := range r.File {
+		if file.FileInfo().IsDir() {
+			if err = fn(file.Name, file.FileInfo(), nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		err = fn(file.Name, file.FileInfo(), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetPath maps an archive entry to its location under dest
+func targetPath(dest, name string) (string, bool, error) {
+	name = strings.TrimPrefix(filepath.ToSlash(name), archivePrefix)
+	if name == "" || name == "go" {
+		return "", false, nil
+	}
+
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, filepath.Clean(dest)+string(filepath.Separator)) {
+		return "", false, fmt.Errorf("archive entry %s escapes destination", name)
+	}
+	return target, true, nil
+}
+
+func writeFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fileMode(mode))
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+
+	// the umask must not make the tree differ from its manifest
+	if err = out.Chmod(fileMode(mode)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,340 @@
+package toolchain
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/cron"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	createTableFile = `CREATE TABLE IF NOT EXISTS toolchain_file (
+    version TEXT NOT NULL,
+    path TEXT NOT NULL,
+    mode INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    PRIMARY KEY (version, path)
+)`
+
+	insertFileQuery  = `INSERT INTO toolchain_file (version, path, mode, sha256) VALUES (?, ?, ?, ?)`
+	selectFilesQuery = `SELECT * FROM toolchain_file WHERE version = ? ORDER BY path`
+	deleteFilesQuery = `DELETE FROM toolchain_file WHERE version = ?`
+)
+
+// DriftKind tells how an installed file differs from the manifest
+type DriftKind string
+
+const (
+	DriftModified DriftKind = "modified"
+	DriftMissing  DriftKind = "missing"
+	DriftMode     DriftKind = "mode"
+	DriftAdded    DriftKind = "added"
+)
+
+// ManifestFile is a file of the release archive as extracted
+type ManifestFile struct {
+	Version string `json:"version,omitempty" db:"version"`
+	Path    string `json:"path" db:"path"`
+	Mode    uint32 `json:"mode" db:"mode"`
+	Sha256  string `json:"sha256" db:"sha256"`
+}
+
+// Drift is a difference between an installed tree and its manifest
+type Drift struct {
+	Path string    `json:"path"`
+	Kind DriftKind `json:"kind"`
+}
+
+// Report is the verification result of a toolchain
+type Report struct {
+	Version  string  `json:"version"`
+	Drift    []Drift `json:"drift,omitempty"`
+	Repaired bool    `json:"repaired,omitempty"`
+}
+
+// OK reports whether the tree matches its manifest
+func (r *Report) OK() bool {
+	return len(r.Drift) == 0
+}
+
+// Manifest returns the recorded files of a toolchain, recording them from
+// the release archive first for toolchains installed without one
+func (m *Manager) Manifest(version string) ([]*ManifestFile, error) {
+	t, err := m.Get(version)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*ManifestFile
+	if err = m.db.SelectContext(m.ctx, &files, selectFilesQuery, version); err != nil {
+		return nil, err
+	}
+
+	if len(files) > 0 {
+		return files, nil
+	}
+
+	archive, err := m.verifiedArchive(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = m.recordManifest(version, archive); err != nil {
+		return nil, err
+	}
+
+	if err = m.db.SelectContext(m.ctx, &files, selectFilesQuery, version); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Verify re-hashes an installed tree against its manifest
+func (m *Manager) Verify(version string) (*Report, error) {
+	t, err := m.Get(version)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := m.Manifest(version)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Version: version}
+	known := make(map[string]bool, len(files))
+
+	for _, f := range files {
+		known[f.Path] = true
+
+		name := filepath.Join(t.GoRoot, filepath.FromSlash(f.Path))
+		info, err := os.Lstat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			report.Drift = append(report.Drift, Drift{Path: f.Path, Kind: DriftMissing})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// a file replaced by a directory or a symlink, dangling or not, is
+		// drift and is not followed
+		if !info.Mode().IsRegular() {
+			report.Drift = append(report.Drift, Drift{Path: f.Path, Kind: DriftModified})
+			continue
+		}
+
+		sum, err := hashFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case sum != f.Sha256:
+			report.Drift = append(report.Drift, Drift{Path: f.Path, Kind: DriftModified})
+		case runtime.GOOS != "windows" && uint32(info.Mode().Perm()) != f.Mode:
+			report.Drift = append(report.Drift, Drift{Path: f.Path, Kind: DriftMode})
+		}
+	}
+
+	err = filepath.WalkDir(t.GoRoot, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(t.GoRoot, name)
+		if err != nil {
+			return err
+		}
+
+		if rel = filepath.ToSlash(rel); !known[rel] {
+			report.Drift = append(report.Drift, Drift{Path: rel, Kind: DriftAdded})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Repair re-extracts a toolchain from its verified release archive, trees
+// adopted by reference belong to another manager and are left alone
+func (m *Manager) Repair(version string) error {
+	t, err := m.Get(version)
+	if err != nil {
+		return err
+	}
+
+	if !m.owns(t) {
+		return fmt.Errorf("%s: adopted from %s, adopt it by copy to repair", version, t.GoRoot)
+	}
+
+	archive, err := m.verifiedArchive(t)
+	if err != nil {
+		return err
+	}
+
+	if err = m.unpack(archive, t.GoRoot); err != nil {
+		return err
+	}
+	return m.recordManifest(version, archive)
+}
+
+// Scrub verifies every installed toolchain, repairing drifted trees when repair is set
+func (m *Manager) Scrub(repair bool) ([]*Report, error) {
+	list, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*Report
+	var errs []error
+	for _, t := range list {
+		report, err := m.Verify(t.Version)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.Version, err))
+			continue
+		}
+
+		if !report.OK() && repair {
+			if err = m.Repair(t.Version); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", t.Version, err))
+			} else {
+				report.Repaired = true
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports, errors.Join(errs...)
+}
+
+// CronJob schedules a scrub of every installed toolchain
+func (m *Manager) CronJob(spec string, repair bool, cron *cron.Cron) error {
+	_, err := cron.AddFunc(spec, func() {
+		reports, err := m.Scrub(repair)
+		if err != nil {
+			slog.Error(err.Error())
+		}
+
+		for _, r := range reports {
+			if !r.OK() {
+				slog.Warn("toolchain drift", "version", r.Version, "files", len(r.Drift), "repaired", r.Repaired)
+			}
+		}
+	})
+	return err
+}
+
+// recordManifest replaces the manifest of a toolchain with the files of its archive
+func (m *Manager) recordManifest(version, archive string) error {
+	files, err := archiveFiles(archive)
+	if err != nil {
+		return err
+	}
+	return m.saveManifest(version, files)
+}
+
+func (m *Manager) saveManifest(version string, files []ManifestFile) error {
+	tx, err := m.db.BeginTxx(m.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(m.ctx, deleteFilesQuery, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, f := range files {
+		if _, err = tx.ExecContext(m.ctx, insertFileQuery, version, f.Path, f.Mode, f.Sha256); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// archiveFiles hashes the regular files of a release archive as they are extracted
+func archiveFiles(archive string) ([]ManifestFile, error) {
+	var files []ManifestFile
+	err := walk(archive, func(name string, info fs.FileInfo, r io.Reader) error {
+		name = strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), archivePrefix)
+		if info.IsDir() || name == "" || name == "go" {
+			return nil
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+
+		files = append(files, ManifestFile{
+			Path:   name,
+			Mode:   uint32(fileMode(info.Mode())),
+			Sha256: fmt.Sprintf("%x", h.Sum(nil)),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// verifiedArchive returns the cached archive of a toolchain once its sha256
+// matches the one recorded at install, a corrupt copy is downloaded again
+func (m *Manager) verifiedArchive(t *Toolchain) (string, error) {
+	file, err := m.catalog.GetFile(t.Version, runtime.GOOS, runtime.GOARCH, archiveKind)
+	if err != nil {
+		return "", err
+	}
+
+	if file.Sha256 != t.Sha256 {
+		return "", fmt.Errorf("%s: catalog checksum differs from the installed archive", t.Version)
+	}
+
+	archive, err := m.fetch(file)
+	if err != nil {
+		return "", err
+	}
+
+	sum, err := hashFile(archive)
+	if err != nil {
+		return "", err
+	}
+
+	if sum == t.Sha256 {
+		return archive, nil
+	}
+
+	slog.Warn("cached archive corrupt, downloading again", "file", file.Filename)
+	if err = os.Remove(archive); err != nil {
+		return "", err
+	}
+	return m.fetch(file)
+}
+
+// fileMode is the permission an extracted file ends up with
+func fileMode(mode fs.FileMode) fs.FileMode {
+	return mode.Perm() | 0o200
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
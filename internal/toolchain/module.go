@@ -0,0 +1,145 @@
+package toolchain
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	goversion "go/version"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// ModulePath is the module the go command downloads toolchains from
+	ModulePath = "golang.org/toolchain"
+
+	// modulePrefix is the pseudo version prefix of every toolchain module
+	modulePrefix = "v0.0.1-"
+)
+
+// moduleExcluded are the top level directories dropped from toolchain modules,
+// as done by cmd/distpack
+var moduleExcluded = []string{"api", "doc", "misc", "test"}
+
+// ModuleVersion returns the golang.org/toolchain version of a release,
+// e.g. v0.0.1-go1.22.4.linux-amd64
+func ModuleVersion(version, goos, arch string) string {
+	if arch == "armv6l" {
+		arch = "arm"
+	}
+	return fmt.Sprintf("%s%s.%s-%s", modulePrefix, version, goos, arch)
+}
+
+// ParseModuleVersion splits a golang.org/toolchain version into the release
+// and the catalog os and arch of its archive
+func ParseModuleVersion(v string) (version, goos, arch string, err error) {
+	rest, ok := strings.CutPrefix(v, modulePrefix)
+	if !ok {
+		return "", "", "", fmt.Errorf("invalid toolchain module version %q", v)
+	}
+
+	i := strings.LastIndex(rest, ".")
+	if i < 0 {
+		return "", "", "", fmt.Errorf("invalid toolchain module version %q", v)
+	}
+
+	version = rest[:i]
+	goos, arch, ok = strings.Cut(rest[i+1:], "-")
+	if !ok || !goversion.IsValid(version) || goos == "" || arch == "" {
+		return "", "", "", fmt.Errorf("invalid toolchain module version %q", v)
+	}
+
+	if arch == "arm" {
+		arch = "armv6l"
+	}
+	return version, goos, arch, nil
+}
+
+// ModuleFile returns the go.mod served for every toolchain module version
+func ModuleFile() []byte {
+	return []byte("module " + ModulePath + "\n")
+}
+
+// WriteModuleZip repackages a release archive into the zip of the toolchain
+// module version modVersion and returns the release time from its VERSION file
+func WriteModuleZip(w io.Writer, archive, modVersion string) (time.Time, error) {
+	var released time.Time
+
+	zw := zip.NewWriter(w)
+	prefix := ModulePath + "@" + modVersion + "/"
+
+	err := walk(archive, func(name string, info fs.FileInfo, r io.Reader) error {
+		name, ok := moduleName(name)
+		if !ok || info.IsDir() {
+			return nil
+		}
+
+		hdr := &zip.FileHeader{Name: prefix + name, Method: zip.Deflate}
+		hdr.SetMode(info.Mode())
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		if name != "VERSION" {
+			_, err = io.Copy(fw, r)
+			return err
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		released = releaseTime(data)
+
+		_, err = fw.Write(data)
+		return err
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err = zw.Close(); err != nil {
+		return time.Time{}, err
+	}
+	return released, nil
+}
+
+// moduleName maps an archive entry to its name inside the module zip
+func moduleName(name string) (string, bool) {
+	name, ok := strings.CutPrefix(path.Clean(strings.ReplaceAll(name, `\`, "/")), archivePrefix)
+	if !ok || name == "" {
+		return "", false
+	}
+
+	top, _, _ := strings.Cut(name, "/")
+	for _, dir := range moduleExcluded {
+		if top == dir {
+			return "", false
+		}
+	}
+
+	// nested go.mod files would split the module, cmd/distpack renames them
+	if path.Base(name) == "go.mod" {
+		name = path.Join(path.Dir(name), "_go.mod")
+	}
+	return name, true
+}
+
+// releaseTime returns the time line of a VERSION file, zero when missing
+func releaseTime(data []byte) time.Time {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "time "); ok {
+			if t, err := time.Parse(time.RFC3339, strings.TrimSpace(value)); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,323 @@
+package toolchain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/downloader"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"github.com/jmoiron/sqlx"
+	goversion "go/version"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const archiveKind = "archive"
+
+const (
+	createTable = `CREATE TABLE IF NOT EXISTS toolchain (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version TEXT NOT NULL UNIQUE,
+    goroot TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+	insertQuery = `INSERT INTO toolchain (version, goroot, filename, sha256) VALUES (?, ?, ?, ?) ON CONFLICT(version) DO UPDATE SET goroot = excluded.goroot, filename = excluded.filename, sha256 = excluded.sha256, updated_at = CURRENT_TIMESTAMP`
+	selectAll   = `SELECT * FROM toolchain ORDER BY version`
+	selectOne   = `SELECT * FROM toolchain WHERE version = ?`
+	deleteQuery = `DELETE FROM toolchain WHERE version = ?`
+)
+
+var ErrNotInstalled = errors.New("toolchain not installed")
+
+type Toolchain struct {
+	ID        int    `json:"id,omitempty" db:"id"`
+	Version   string `json:"version,omitempty" db:"version"`
+	GoRoot    string `json:"goroot,omitempty" db:"goroot"`
+	Filename  string `json:"filename,omitempty" db:"filename"`
+	Sha256    string `json:"sha256,omitempty" db:"sha256"`
+	CreatedAt string `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt string `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+type Manager struct {
+	db      *sqlx.DB
+	ctx     context.Context
+	catalog *mapper.MapVersions
+	store   *artifact.Store
+	dir     string
+}
+
+func NewManager(ctx context.Context, db *sqlx.DB, catalog *mapper.MapVersions, store *artifact.Store, dir string) (*Manager, error) {
+	m := &Manager{
+		db:      db,
+		ctx:     ctx,
+		catalog: catalog,
+		store:   store,
+		dir:     dir,
+	}
+
+	if _, err := m.db.ExecContext(ctx, createTable); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.db.ExecContext(ctx, createTableFile); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.db.ExecContext(ctx, createTableUsage); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.db.ExecContext(ctx, createTableAlias); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.db.ExecContext(ctx, createTableAliasHistory); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Get returns an installed toolchain
+func (m *Manager) Get(version string) (*Toolchain, error) {
+	var t Toolchain
+	if err := m.db.GetContext(m.ctx, &t, selectOne, version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", version, ErrNotInstalled)
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// List returns every installed toolchain
+func (m *Manager) List() ([]*Toolchain, error) {
+	var t []*Toolchain
+	if err := m.db.SelectContext(m.ctx, &t, selectAll); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Ensure returns the toolchain, installing it first when missing
+func (m *Manager) Ensure(version string) (*Toolchain, error) {
+	t, err := m.Get(version)
+	if err == nil {
+		return t, nil
+	}
+
+	if !errors.Is(err, ErrNotInstalled) {
+		return nil, err
+	}
+	return m.Install(version)
+}
+
+// Resolve turns a version or a spec such as latest-1 or >=1.21 into a release,
+// an installed toolchain wins even when the catalog does not list it
+func (m *Manager) Resolve(spec string) (string, error) {
+	if t, err := m.Get("go" + strings.TrimPrefix(spec, "go")); err == nil {
+		return t.Version, nil
+	}
+
+	if version, err := m.GetAlias(spec); err != nil || version != "" {
+		if err != nil {
+			return "", err
+		}
+		return m.Lookup(version)
+	}
+	return m.catalog.Resolve(spec)
+}
+
+// Newest returns the newest stable release of a line such as 1.22, or of
+// the catalog when line is empty
+func (m *Manager) Newest(line string) (string, error) {
+	list, err := m.Versions(false)
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range list {
+		if line == "" || goversion.Lang(v) == "go"+strings.TrimPrefix(line, "go") {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("no stable release of %q in catalog", line)
+}
+
+// Match returns the catalog releases satisfying a constraint, newest first
+func (m *Manager) Match(constraint string, unstable bool) ([]string, error) {
+	return m.catalog.Match(constraint, unstable)
+}
+
+// Versions returns the catalog releases, newest first, stable only unless unstable is set
+func (m *Manager) Versions(unstable bool) ([]string, error) {
+	all, err := m.catalog.GetVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(all))
+	for _, v := range all {
+		if v.Stable || unstable {
+			out = append(out, v.Version)
+		}
+	}
+	return out, nil
+}
+
+// Install downloads the release archive for this platform and extracts it
+func (m *Manager) Install(version string) (*Toolchain, error) {
+	file, err := m.catalog.GetFile(version, runtime.GOOS, runtime.GOARCH, archiveKind)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s for %s/%s not found in catalog", version, runtime.GOOS, runtime.GOARCH)
+		}
+		return nil, err
+	}
+
+	archive, err := m.fetch(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// a leftover tree of an earlier install is not trusted
+	goroot := filepath.Join(m.dir, version)
+	if err = m.unpack(archive, goroot); err != nil {
+		return nil, err
+	}
+
+	if _, err = m.db.ExecContext(m.ctx, insertQuery, version, goroot, file.Filename, file.Sha256); err != nil {
+		return nil, err
+	}
+
+	if err = m.recordManifest(version, archive); err != nil {
+		return nil, err
+	}
+	return m.Get(version)
+}
+
+// Uninstall removes the toolchain record and the tree when moonlight created it
+func (m *Manager) Uninstall(version string) error {
+	t, err := m.Get(version)
+	if err != nil {
+		return err
+	}
+
+	if m.owns(t) {
+		if err = os.RemoveAll(t.GoRoot); err != nil {
+			return err
+		}
+	}
+
+	if _, err = m.db.ExecContext(m.ctx, deleteFilesQuery, version); err != nil {
+		return err
+	}
+
+	if _, err = m.db.ExecContext(m.ctx, deleteUsageQuery, version); err != nil {
+		return err
+	}
+
+	_, err = m.db.ExecContext(m.ctx, deleteQuery, version)
+	return err
+}
+
+// fetch returns the cached archive, downloading it when missing
+func (m *Manager) fetch(file *mapper.File) (string, error) {
+	if !m.store.Has(artifact.Downloads, file.Filename) {
+		dir, err := m.store.Dir(artifact.Downloads)
+		if err != nil {
+			return "", err
+		}
+
+		if err = downloader.DownloadGoVersion(file.Filename, file.Sha256, dir); err != nil {
+			return "", err
+		}
+	}
+	return m.store.Path(artifact.Downloads, file.Filename)
+}
+
+// unpack extracts into a temporary sibling and renames it into place
+func (m *Manager) unpack(archive, goroot string) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(m.dir, ".extract-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err = extract(archive, tmp); err != nil {
+		return err
+	}
+
+	if err = os.RemoveAll(goroot); err != nil {
+		return err
+	}
+	return os.Rename(tmp, goroot)
+}
+
+// Bin returns the path of a binary inside the toolchain
+func (t *Toolchain) Bin(name string) string {
+	return filepath.Join(t.GoRoot, "bin", binName(name))
+}
+
+// LookPath finds a command in the toolchain bin directory first, then in PATH
+func (t *Toolchain) LookPath(name string) (string, error) {
+	if filepath.Base(name) == name {
+		for _, bin := range []string{"go", "gofmt"} {
+			if name == bin || name == bin+".exe" {
+				return t.Bin(bin), nil
+			}
+		}
+	}
+	return exec.LookPath(name)
+}
+
+// Command prepares name to run under the toolchain, nested shims are pinned
+// to the same version through MOONLIGHT_GO_VERSION
+func (t *Toolchain) Command(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	path, err := t.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(t.Environ(os.Environ()), resolver.EnvVersion+"="+t.Version)
+	return cmd, nil
+}
+
+// Environ returns env with GOROOT and PATH set for the toolchain
+// and GOTOOLCHAIN=local so the go command does not switch again
+func (t *Toolchain) Environ(env []string) []string {
+	out := make([]string, 0, len(env)+3)
+	path := filepath.Join(t.GoRoot, "bin")
+
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		switch strings.ToUpper(key) {
+		case "GOROOT", "GOTOOLCHAIN":
+			continue
+		case "PATH":
+			if value != "" {
+				path += string(os.PathListSeparator) + value
+			}
+			continue
+		}
+		out = append(out, kv)
+	}
+
+	return append(out, "GOROOT="+t.GoRoot, "PATH="+path, "GOTOOLCHAIN=local")
+}
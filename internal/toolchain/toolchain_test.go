@@ -0,0 +1,388 @@
+package toolchain
+
+import (
+	"context"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"github.com/inovacc/moonlight/internal/toolchain/toolchaintest"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+const testVersion = "go1.22.4"
+
+func TestManager(t *testing.T) {
+	m := newTestManager(t)
+
+	tc, err := m.Ensure(testVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, testVersion, tc.Version)
+	assert.FileExists(t, filepath.Join(tc.GoRoot, "bin", "go"))
+	assert.FileExists(t, filepath.Join(tc.GoRoot, "VERSION"))
+
+	list, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, list, 1)
+
+	if err = m.SetAlias(GlobalAlias, testVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	global, err := m.Global()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, testVersion, global)
+
+	env := tc.Environ([]string{"PATH=/usr/bin", "GOROOT=/usr/local/go", "HOME=/home/gopher"})
+	assert.Contains(t, env, "GOROOT="+tc.GoRoot)
+	assert.Contains(t, env, "PATH="+filepath.Join(tc.GoRoot, "bin")+string(os.PathListSeparator)+"/usr/bin")
+	assert.Contains(t, env, "GOTOOLCHAIN=local")
+	assert.NotContains(t, env, "GOROOT=/usr/local/go")
+
+	if err = m.Uninstall(testVersion); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoDirExists(t, tc.GoRoot)
+
+	_, err = m.Get(testVersion)
+	assert.ErrorIs(t, err, ErrNotInstalled)
+}
+
+func TestInstallUnknownVersion(t *testing.T) {
+	m := newTestManager(t)
+
+	_, err := m.Install("go1.0.0")
+	assert.Error(t, err)
+}
+
+func TestTargetPath(t *testing.T) {
+	dest := t.TempDir()
+
+	_, ok, err := targetPath(dest, "go/")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	path, ok, err := targetPath(dest, "go/bin/go")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dest, "bin", "go"), path)
+
+	_, _, err = targetPath(dest, "go/../../etc/passwd")
+	assert.Error(t, err)
+}
+
+// newTestManager returns a manager whose catalog and artifact store already
+// hold a fake release archive, so no download happens
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	catalog, store := toolchaintest.NewReleases(t, testVersion)
+	m, err := NewManager(context.Background(), database.GetConnection(), catalog, store, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestAliasRollback(t *testing.T) {
+	m := newTestManager(t)
+
+	_, err := m.Rollback(GlobalAlias)
+	assert.ErrorIs(t, err, ErrNoHistory)
+
+	for _, v := range []string{"go1.22.2", "go1.22.3", testVersion} {
+		if err = m.SetAlias(GlobalAlias, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := m.History(GlobalAlias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, history, 2)
+	assert.Equal(t, "go1.22.3", history[0].Previous)
+
+	version, err := m.Rollback(GlobalAlias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.22.3", version)
+
+	version, err = m.Rollback(GlobalAlias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.22.2", version)
+
+	_, err = m.Rollback(GlobalAlias)
+	assert.ErrorIs(t, err, ErrNoHistory)
+
+	// global may follow a channel alias
+	if err = m.SetAlias("stable", testVersion); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.SetAlias(GlobalAlias, "stable"); err != nil {
+		t.Fatal(err)
+	}
+
+	global, err := m.Global()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, testVersion, global)
+}
+
+func TestModuleVersion(t *testing.T) {
+	v := ModuleVersion("go1.22.4", "linux", "armv6l")
+	assert.Equal(t, "v0.0.1-go1.22.4.linux-arm", v)
+
+	version, goos, arch, err := ParseModuleVersion(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"go1.22.4", "linux", "armv6l"}, []string{version, goos, arch})
+
+	version, _, _, err = ParseModuleVersion("v0.0.1-go1.23rc1.windows-amd64")
+	assert.NoError(t, err)
+	assert.Equal(t, "go1.23rc1", version)
+
+	for _, bad := range []string{"v1.0.0", "v0.0.1-go1.22.4", "v0.0.1-go1.22.4.linux", "v0.0.1-gox.linux-amd64"} {
+		_, _, _, err = ParseModuleVersion(bad)
+		assert.Error(t, err, bad)
+	}
+
+	name, ok := moduleName("go/src/cmd/go.mod")
+	assert.True(t, ok)
+	assert.Equal(t, "src/cmd/_go.mod", name)
+
+	_, ok = moduleName("go/test/run.go")
+	assert.False(t, ok)
+
+	name, ok = moduleName("go/bin/go")
+	assert.True(t, ok)
+	assert.Equal(t, "bin/go", name)
+}
+
+func TestVerifyRepair(t *testing.T) {
+	m := newTestManager(t)
+
+	tc, err := m.Install(testVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := m.Verify(testVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.OK(), report.Drift)
+
+	if err = os.WriteFile(tc.Bin("go"), []byte("#!/bin/sh\necho patched\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(tc.Bin("gofmt")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(tc.GoRoot, "extra.go"), []byte("package extra\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a file replaced by a directory or a dangling symlink is drift, not an error
+	version := filepath.Join(tc.GoRoot, "VERSION")
+	if err = os.Remove(version); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(version, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	goMod := filepath.Join(tc.GoRoot, "src", "go.mod")
+	if err = os.Remove(goMod); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(filepath.Join(t.TempDir(), "missing"), goMod); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = m.Verify(testVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []Drift{
+		{Path: "VERSION", Kind: DriftModified},
+		{Path: "bin/go", Kind: DriftModified},
+		{Path: "bin/gofmt", Kind: DriftMissing},
+		{Path: "extra.go", Kind: DriftAdded},
+		{Path: "src/go.mod", Kind: DriftModified},
+	}, report.Drift)
+
+	reports, err := m.Scrub(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, reports, 1)
+	assert.True(t, reports[0].Repaired)
+
+	report, err = m.Verify(testVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.OK(), report.Drift)
+}
+
+func TestAdopt(t *testing.T) {
+	m := newTestManager(t)
+	home := t.TempDir()
+	for _, key := range []string{"GVM_ROOT", "GOENV_ROOT", "ASDF_DATA_DIR"} {
+		t.Setenv(key, "")
+	}
+
+	saved := tarballRoot
+	tarballRoot = filepath.Join(home, "missing")
+	t.Cleanup(func() { tarballRoot = saved })
+
+	archive, err := m.store.Path(artifact.Downloads, fmt.Sprintf("%s.%s-%s.tar.gz", testVersion, runtime.GOOS, runtime.GOARCH))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goenv := filepath.Join(home, ".goenv", "versions", "1.22.4")
+	sdk := filepath.Join(home, "sdk", testVersion)
+	for _, dir := range []string{goenv, sdk} {
+		if err = extract(archive, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = os.WriteFile(filepath.Join(sdk, "bin", "gofmt"), []byte("changed"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates, err := Discover(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, candidates, 2)
+
+	for _, c := range candidates {
+		a, err := m.Check(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch c.Source {
+		case "goenv":
+			assert.True(t, a.Verified)
+		case "golang.org/dl":
+			assert.False(t, a.Verified)
+			assert.Equal(t, []Drift{{Path: "bin/gofmt", Kind: DriftModified}}, a.Drift)
+		}
+	}
+
+	a, err := m.Check(candidates[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc, err := m.Adopt(a, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, goenv, tc.GoRoot)
+
+	_, err = m.Adopt(a, true)
+	assert.ErrorIs(t, err, ErrInstalled)
+
+	report, err := m.Verify(testVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, report.OK(), report.Drift)
+	assert.Error(t, m.Repair(testVersion))
+
+	// the tree belongs to goenv and survives the uninstall
+	if err = m.Uninstall(testVersion); err != nil {
+		t.Fatal(err)
+	}
+	assert.FileExists(t, filepath.Join(goenv, "bin", "go"))
+
+	tc, err = m.Adopt(a, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, filepath.Join(m.dir, testVersion), tc.GoRoot)
+	assert.FileExists(t, tc.Bin("go"))
+}
+
+func TestGC(t *testing.T) {
+	m := newTestManager(t)
+
+	// the environment of the caller does not hide project pins
+	t.Setenv(resolver.EnvVersion, "go1.21.0")
+	t.Setenv("GOWORK", filepath.Join(t.TempDir(), "go.work"))
+
+	if _, err := m.Install(testVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	project := t.TempDir()
+	pin := filepath.Join(project, ".go-version")
+	if err := os.WriteFile(pin, []byte("1.22.4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.RecordUsage(testVersion, project); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := m.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, list, 1)
+	assert.Equal(t, 2, list[0].Invocations)
+	assert.Equal(t, 1, list[0].Projects)
+	assert.Equal(t, pin, list[0].Pinned)
+	assert.Positive(t, list[0].Size)
+
+	// a recent, pinned toolchain survives both rules
+	removed, err := m.GC(GCPolicy{UnusedFor: time.Hour, Budget: 1})
+	assert.Error(t, err)
+	assert.Empty(t, removed)
+
+	if err = os.Remove(pin); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err = m.GC(GCPolicy{UnusedFor: time.Hour, Budget: 1, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, removed, 1)
+
+	_, err = m.Get(testVersion)
+	assert.NoError(t, err)
+
+	removed, err = m.GC(GCPolicy{Budget: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, removed, 1)
+
+	_, err = m.Get(testVersion)
+	assert.ErrorIs(t, err, ErrNotInstalled)
+}
@@ -0,0 +1,126 @@
+// Package toolchaintest builds release catalogs and cached release archives
+// for tests, so installs never download anything
+package toolchaintest
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/artifact"
+	"github.com/inovacc/moonlight/internal/database/databasetest"
+	"github.com/inovacc/moonlight/internal/mapper"
+	"github.com/inovacc/moonlight/pkg/versions"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// ArchiveKind is the catalog kind of release archives
+const ArchiveKind = "archive"
+
+// NewStore returns an artifact store in a temporary directory
+func NewStore(t testing.TB) *artifact.Store {
+	t.Helper()
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// NewCatalog opens a temporary database holding goVer
+func NewCatalog(t testing.TB, goVer *versions.GoVersion) *mapper.MapVersions {
+	t.Helper()
+
+	catalog, err := mapper.NewMapVersions(context.Background(), databasetest.Open(t), goVer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return catalog
+}
+
+// NewReleases returns a catalog of stable releases, newest first, each with
+// an archive for this platform already cached in the store
+func NewReleases(t testing.TB, releases ...string) (*mapper.MapVersions, *artifact.Store) {
+	t.Helper()
+
+	store := NewStore(t)
+	goVer := &versions.GoVersion{StableVersion: releases[0]}
+	for _, v := range releases {
+		goVer.Versions = append(goVer.Versions, versions.Versions{
+			Version: v,
+			Stable:  true,
+			Files:   []versions.File{Archive(t, store, v, runtime.GOOS, runtime.GOARCH)},
+		})
+	}
+	return NewCatalog(t, goVer), store
+}
+
+// Archive caches the release archive of version for a platform and returns
+// its catalog entry
+func Archive(t testing.TB, store *artifact.Store, version, goos, arch string) versions.File {
+	t.Helper()
+
+	filename := fmt.Sprintf("%s.%s-%s.tar.gz", version, goos, arch)
+	return versions.File{
+		Filename: filename,
+		Os:       goos,
+		Arch:     arch,
+		Sha256:   WriteArchive(t, store, filename, version),
+		Size:     1,
+		Kind:     ArchiveKind,
+	}
+}
+
+// WriteArchive stores a minimal go release archive and returns its sha256,
+// the go binary is a script printing the version
+func WriteArchive(t testing.TB, store *artifact.Store, filename, version string) string {
+	t.Helper()
+
+	w, err := store.Create(artifact.Downloads, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(w, h))
+	tw := tar.NewWriter(gz)
+
+	files := []struct{ name, content string }{
+		{"go/VERSION", version + "\ntime 2024-05-30T19:26:07Z\n"},
+		{"go/bin/go", "#!/bin/sh\necho " + version + "\n"},
+		{"go/bin/gofmt", "#!/bin/sh\n"},
+		{"go/src/go.mod", "module std\n"},
+		{"go/test/run.go", "package main\n"},
+		{"go/doc/go_spec.html", "<html>\n"},
+	}
+
+	for _, f := range files {
+		mode := int64(0o644)
+		if strings.HasPrefix(f.name, "go/bin/") {
+			mode = 0o755
+		}
+
+		if err = tw.WriteHeader(&tar.Header{Name: f.name, Mode: mode, Size: int64(len(f.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
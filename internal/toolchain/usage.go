@@ -0,0 +1,186 @@
+package toolchain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/resolver"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	createTableUsage = `CREATE TABLE IF NOT EXISTS toolchain_usage (
+    version TEXT NOT NULL,
+    dir TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 1,
+    last_used INTEGER NOT NULL,
+    PRIMARY KEY (version, dir)
+)`
+
+	upsertUsageQuery = `INSERT INTO toolchain_usage (version, dir, last_used) VALUES (?, ?, ?) ON CONFLICT(version, dir) DO UPDATE SET count = count + 1, last_used = excluded.last_used`
+	selectUsageQuery = `SELECT t.version AS version, t.goroot AS goroot,
+    COALESCE(MAX(u.last_used), CAST(strftime('%s', t.created_at) AS INTEGER)) AS last_used,
+    COALESCE(SUM(u.count), 0) AS invocations,
+    COUNT(u.dir) AS projects
+FROM toolchain t LEFT JOIN toolchain_usage u ON u.version = t.version
+GROUP BY t.version, t.goroot
+ORDER BY last_used`
+	selectUsageDirsQuery = `SELECT DISTINCT dir FROM toolchain_usage`
+	deleteUsageQuery     = `DELETE FROM toolchain_usage WHERE version = ?`
+)
+
+// Usage is how much an installed toolchain is used, never used toolchains
+// count as last used when they were installed
+type Usage struct {
+	Version     string `json:"version" db:"version"`
+	GoRoot      string `json:"goroot" db:"goroot"`
+	LastUsed    int64  `json:"last_used" db:"last_used"`
+	Invocations int    `json:"invocations" db:"invocations"`
+	Projects    int    `json:"projects" db:"projects"`
+	Size        int64  `json:"size"`
+	Pinned      string `json:"pinned,omitempty"`
+}
+
+// GCPolicy selects the toolchains removed by GC, zero values disable a rule
+type GCPolicy struct {
+	UnusedFor time.Duration
+	Budget    int64
+	DryRun    bool
+}
+
+// RecordUsage counts an invocation of a toolchain from a project directory
+func (m *Manager) RecordUsage(version, dir string) error {
+	_, err := m.db.ExecContext(m.ctx, upsertUsageQuery, version, dir, time.Now().Unix())
+	return err
+}
+
+// Usage returns every installed toolchain, least recently used first, with
+// the disk space of the trees moonlight owns
+func (m *Manager) Usage() ([]*Usage, error) {
+	var list []*Usage
+	if err := m.db.SelectContext(m.ctx, &list, selectUsageQuery); err != nil {
+		return nil, err
+	}
+
+	pinned, err := m.Pinned()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range list {
+		u.Pinned = pinned[u.Version]
+		if m.owns(&Toolchain{GoRoot: u.GoRoot}) {
+			if u.Size, err = dirSize(u.GoRoot); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return list, nil
+}
+
+// Pinned returns the versions that must stay installed and what pins them:
+// aliases such as the global default, and the pins of projects that used a
+// toolchain and still exist
+func (m *Manager) Pinned() (map[string]string, error) {
+	pinned := make(map[string]string)
+
+	aliases, err := m.Aliases()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range aliases {
+		if version, err := m.lookup(a.Name); err == nil && version != "" {
+			pinned[version] = "alias " + a.Name
+		}
+	}
+
+	var dirs []string
+	if err = m.db.SelectContext(m.ctx, &dirs, selectUsageDirsQuery); err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+
+		// resolve as the project sees it, not as the environment of this
+		// process, e.g. under moonlight exec, would override it
+		sel, err := resolver.ResolveEnv(dir, func(string) string { return "" }, nil)
+		if err != nil || sel.Source == resolver.SourceEnv {
+			continue
+		}
+
+		if version, err := m.Lookup(sel.Version); err == nil {
+			if _, ok := pinned[version]; !ok {
+				pinned[version] = sel.Path
+			}
+		}
+	}
+	return pinned, nil
+}
+
+// GC uninstalls unpinned toolchains unused for longer than UnusedFor, then the
+// least recently used ones until the owned trees fit in Budget
+func (m *Manager) GC(policy GCPolicy) ([]*Usage, error) {
+	list, err := m.Usage()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, u := range list {
+		total += u.Size
+	}
+
+	var removed []*Usage
+	cutoff := time.Now().Add(-policy.UnusedFor).Unix()
+
+	// list is least recently used first
+	for _, u := range list {
+		if u.Pinned != "" {
+			continue
+		}
+
+		stale := policy.UnusedFor > 0 && u.LastUsed < cutoff
+		overBudget := policy.Budget > 0 && total > policy.Budget
+		if !stale && !overBudget {
+			continue
+		}
+
+		if !policy.DryRun {
+			if err = m.Uninstall(u.Version); err != nil {
+				return removed, fmt.Errorf("%s: %w", u.Version, err)
+			}
+		}
+
+		total -= u.Size
+		removed = append(removed, u)
+	}
+
+	if policy.Budget > 0 && total > policy.Budget {
+		return removed, errors.New("pinned toolchains alone exceed the disk budget")
+	}
+	return removed, nil
+}
+
+// dirSize returns the size of the regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,218 @@
+package upgrade
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/jmoiron/sqlx"
+	goversion "go/version"
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+const stableChannel = "stable"
+
+const (
+	createTableSeen = `CREATE TABLE IF NOT EXISTS upgrade_seen (
+    version TEXT PRIMARY KEY,
+    seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+	createTableApplied = `CREATE TABLE IF NOT EXISTS upgrade_applied (
+    channel TEXT NOT NULL,
+    version TEXT NOT NULL,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel, version)
+)`
+
+	insertSeenQuery = `INSERT INTO upgrade_seen (version, seen_at) VALUES (?, ?) ON CONFLICT(version) DO NOTHING`
+	selectSeenQuery = `SELECT seen_at FROM upgrade_seen WHERE version = ?`
+
+	insertAppliedQuery = `INSERT INTO upgrade_applied (channel, version) VALUES (?, ?) ON CONFLICT(channel, version) DO NOTHING`
+	countAppliedQuery  = `SELECT COUNT(*) FROM upgrade_applied WHERE channel = ? AND version = ?`
+)
+
+// lineRE matches a channel naming a release line such as 1.22
+var lineRE = regexp.MustCompile(`^(go)?1\.\d+$`)
+
+// Change is a channel moved to a new release
+type Change struct {
+	Channel string `json:"channel"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to"`
+}
+
+type Upgrader struct {
+	db      *sqlx.DB
+	ctx     context.Context
+	manager *toolchain.Manager
+	policy  config.Upgrade
+	now     func() time.Time
+}
+
+func NewUpgrader(ctx context.Context, db *sqlx.DB, manager *toolchain.Manager, policy config.Upgrade) (*Upgrader, error) {
+	u := &Upgrader{
+		db:      db,
+		ctx:     ctx,
+		manager: manager,
+		policy:  policy,
+		now:     time.Now,
+	}
+
+	if _, err := u.db.ExecContext(ctx, createTableSeen); err != nil {
+		return nil, err
+	}
+
+	if _, err := u.db.ExecContext(ctx, createTableApplied); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// Run moves every channel of the policy to its newest release once that
+// release is older than the adoption delay, then prunes old installs
+func (u *Upgrader) Run() ([]Change, error) {
+	var changes []Change
+	var errs []error
+
+	for _, channel := range u.policy.Channels {
+		change, err := u.upgrade(channel)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", channel, err))
+			continue
+		}
+
+		if change == nil {
+			continue
+		}
+		changes = append(changes, *change)
+
+		slog.Info("toolchain channel upgraded", "channel", change.Channel, "from", change.From, "to", change.To)
+
+		if err = u.prune(channel); err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", channel, err))
+		}
+	}
+	return changes, errors.Join(errs...)
+}
+
+func (u *Upgrader) upgrade(channel string) (*Change, error) {
+	current, err := u.manager.GetAlias(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := u.target(channel, current)
+	if err != nil || target == "" || target == current {
+		return nil, err
+	}
+
+	// never move a channel backwards, e.g. after a manual switch
+	if current != "" && goversion.IsValid(current) && goversion.Compare(target, current) <= 0 {
+		return nil, nil
+	}
+
+	// a target adopted before and no longer current was rolled back
+	applied, err := u.applied(channel, target)
+	if err != nil || applied {
+		return nil, err
+	}
+
+	ready, err := u.ready(target)
+	if err != nil || !ready {
+		return nil, err
+	}
+
+	if _, err = u.manager.Ensure(target); err != nil {
+		return nil, err
+	}
+
+	if err = u.manager.SetAlias(channel, target); err != nil {
+		return nil, err
+	}
+
+	if _, err = u.db.ExecContext(u.ctx, insertAppliedQuery, channel, target); err != nil {
+		return nil, err
+	}
+	return &Change{Channel: channel, From: current, To: target}, nil
+}
+
+// applied reports whether a channel was already upgraded to version
+func (u *Upgrader) applied(channel, version string) (bool, error) {
+	var n int
+	if err := u.db.GetContext(u.ctx, &n, countAppliedQuery, channel, version); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// target returns the release a channel should point at
+func (u *Upgrader) target(channel, current string) (string, error) {
+	switch {
+	case channel == stableChannel:
+		return u.manager.Newest("")
+	case lineRE.MatchString(channel):
+		return u.manager.Newest(channel)
+	case goversion.IsValid(current):
+		return u.manager.Newest(goversion.Lang(current))
+	default:
+		// unset, or pointing at another alias which is upgraded on its own
+		return "", nil
+	}
+}
+
+// ready records when a release was first seen and reports whether the
+// adoption delay has passed
+func (u *Upgrader) ready(version string) (bool, error) {
+	now := u.now().UTC()
+	if _, err := u.db.ExecContext(u.ctx, insertSeenQuery, version, now); err != nil {
+		return false, err
+	}
+
+	var seenAt time.Time
+	if err := u.db.GetContext(u.ctx, &seenAt, selectSeenQuery, version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return now.Sub(seenAt) >= u.policy.Delay, nil
+}
+
+// prune uninstalls the previous targets of a channel beyond the rollback
+// window, toolchains pinned by an alias or a project are kept as gc does
+func (u *Upgrader) prune(channel string) error {
+	history, err := u.manager.History(channel)
+	if err != nil {
+		return err
+	}
+
+	pinned, err := u.manager.Pinned()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	kept := 0
+	for _, h := range history {
+		if _, ok := pinned[h.Previous]; ok || seen[h.Previous] {
+			continue
+		}
+		seen[h.Previous] = true
+
+		if kept < u.policy.Keep {
+			kept++
+			continue
+		}
+
+		if err = u.manager.Uninstall(h.Previous); err != nil && !errors.Is(err, toolchain.ErrNotInstalled) {
+			return err
+		}
+	}
+	return nil
+}
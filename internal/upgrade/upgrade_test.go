@@ -0,0 +1,112 @@
+package upgrade
+
+import (
+	"context"
+	"github.com/inovacc/moonlight/internal/config"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/inovacc/moonlight/internal/toolchain/toolchaintest"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	releases := []string{"go1.22.4", "go1.22.3", "go1.22.2", "go1.22.1", "go1.21.11"}
+	m := newTestManager(t, releases)
+
+	// the channel currently sits on older patches, each adopted in turn
+	for _, v := range []string{"go1.22.1", "go1.22.2", "go1.22.3"} {
+		if _, err := m.Ensure(v); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.SetAlias("stable", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.SetAlias("1.21", "go1.21.11"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a project still pins go1.22.1
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, ".go-version"), []byte("1.22.1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RecordUsage("go1.22.1", project); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := config.Upgrade{Enabled: true, Channels: []string{"stable", "1.21", "unset"}, Delay: time.Hour, Keep: 1}
+	u, err := NewUpgrader(context.Background(), database.GetConnection(), m, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	u.now = func() time.Time { return now }
+
+	// first sighting only starts the delay
+	changes, err := u.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, changes)
+
+	now = now.Add(2 * time.Hour)
+	changes, err = u.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Change{{Channel: "stable", From: "go1.22.3", To: "go1.22.4"}}, changes)
+
+	stable, err := m.GetAlias("stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.22.4", stable)
+
+	// go1.22.3 stays for rollback, go1.22.2 falls out of the window and the
+	// project pin keeps go1.22.1
+	_, err = m.Get("go1.22.3")
+	assert.NoError(t, err)
+	_, err = m.Get("go1.22.2")
+	assert.ErrorIs(t, err, toolchain.ErrNotInstalled)
+	_, err = m.Get("go1.22.1")
+	assert.NoError(t, err)
+
+	version, err := m.Rollback("stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.22.3", version)
+
+	// a rolled back release is not adopted again
+	changes, err = u.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, changes)
+
+	stable, err = m.GetAlias("stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "go1.22.3", stable)
+}
+
+// newTestManager returns a manager whose catalog and artifact store hold
+// fake archives for every release
+func newTestManager(t *testing.T, releases []string) *toolchain.Manager {
+	t.Helper()
+
+	catalog, store := toolchaintest.NewReleases(t, releases...)
+	m, err := toolchain.NewManager(context.Background(), database.GetConnection(), catalog, store, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
@@ -0,0 +1,302 @@
+package vuln
+
+import (
+	"errors"
+	"fmt"
+	"github.com/inovacc/moonlight/internal/cron"
+	"github.com/inovacc/moonlight/internal/installer"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"log/slog"
+	"strings"
+)
+
+// Kinds of scan targets
+const (
+	KindTool      = "tool"
+	KindToolchain = "toolchain"
+)
+
+// Kinds of events
+const (
+	EventFound    = "found"
+	EventResolved = "resolved"
+)
+
+const (
+	createTableFinding = `CREATE TABLE IF NOT EXISTS vuln_finding (
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    module TEXT NOT NULL,
+    version TEXT NOT NULL,
+    vuln_id TEXT NOT NULL,
+    fixed TEXT NOT NULL,
+    symbols TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kind, target, module, vuln_id)
+)`
+
+	createTableEvent = `CREATE TABLE IF NOT EXISTS vuln_event (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    module TEXT NOT NULL,
+    version TEXT NOT NULL,
+    vuln_id TEXT NOT NULL,
+    fixed TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+	selectFindingsQuery = `SELECT kind, target, module, version, vuln_id, fixed FROM vuln_finding`
+	deleteFindingsQuery = `DELETE FROM vuln_finding`
+	insertFindingQuery  = `INSERT OR REPLACE INTO vuln_finding (kind, target, module, version, vuln_id, fixed, symbols) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	insertEventQuery    = `INSERT INTO vuln_event (event, kind, target, module, version, vuln_id, fixed) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	selectEventsQuery   = `SELECT * FROM vuln_event ORDER BY id DESC LIMIT ?`
+)
+
+// Tools lists the installed tools and the build info recorded from their binaries
+type Tools interface {
+	Installs() ([]*installer.Install, error)
+	BuildInfo(in *installer.Install) (*installer.BuildInfo, error)
+}
+
+// Toolchains lists the managed toolchains
+type Toolchains interface {
+	List() ([]*toolchain.Toolchain, error)
+}
+
+// Target is a binary or a toolchain and the modules it is built from
+type Target struct {
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Modules []Module `json:"modules"`
+}
+
+// Finding is a vulnerability affecting a target
+type Finding struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	*Match
+}
+
+// Event is a finding that appeared or went away between two scans
+type Event struct {
+	ID        int    `json:"id" db:"id"`
+	Event     string `json:"event" db:"event"`
+	Kind      string `json:"kind" db:"kind"`
+	Target    string `json:"target" db:"target"`
+	Module    string `json:"module" db:"module"`
+	Version   string `json:"version" db:"version"`
+	VulnID    string `json:"vuln_id" db:"vuln_id"`
+	Fixed     string `json:"fixed,omitempty" db:"fixed"`
+	CreatedAt string `json:"created_at,omitempty" db:"created_at"`
+}
+
+// ToolTarget returns the target of a binary, its main module, every linked
+// module, replacements in place of what they replace, and its stdlib
+func ToolTarget(name string, b *installer.BuildInfo) *Target {
+	t := &Target{Kind: KindTool, Name: name}
+	if b.Version != "" && b.Version != "(devel)" {
+		t.Modules = append(t.Modules, Module{Path: b.Module, Version: b.Version})
+	}
+
+	for _, d := range b.Deps {
+		m := Module{Path: d.Path, Version: d.Version}
+		if d.ReplacePath != "" && d.ReplaceVersion != "" {
+			m = Module{Path: d.ReplacePath, Version: d.ReplaceVersion}
+		}
+		t.Modules = append(t.Modules, m)
+	}
+
+	t.Modules = append(t.Modules, Module{Path: Stdlib, Version: b.GoRelease()})
+	return t
+}
+
+// ToolchainTarget returns the target of a toolchain, its stdlib and the go
+// command
+func ToolchainTarget(version string) *Target {
+	return &Target{
+		Kind: KindToolchain,
+		Name: version,
+		Modules: []Module{
+			{Path: Stdlib, Version: version},
+			{Path: Toolchain, Version: version},
+		},
+	}
+}
+
+// Check returns the vulnerabilities affecting a target
+func (d *DB) Check(t *Target) ([]*Finding, error) {
+	var findings []*Finding
+	for _, m := range t.Modules {
+		matches, err := d.Match(m)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			findings = append(findings, &Finding{Kind: t.Kind, Target: t.Name, Match: match})
+		}
+	}
+	return findings, nil
+}
+
+// Targets returns every installed tool binary with recorded build info and
+// every managed toolchain
+func Targets(tools Tools, toolchains Toolchains) ([]*Target, error) {
+	var targets []*Target
+	if tools != nil {
+		installs, err := tools.Installs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, in := range installs {
+			b, err := tools.BuildInfo(in)
+			if err != nil {
+				// installs made before build info was recorded cannot be scanned
+				if errors.Is(err, installer.ErrNoBuildInfo) {
+					continue
+				}
+				return nil, err
+			}
+			targets = append(targets, ToolTarget(in.Binary()+"@"+in.Version, b))
+		}
+	}
+
+	if toolchains != nil {
+		list, err := toolchains.List()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range list {
+			targets = append(targets, ToolchainTarget(t.Version))
+		}
+	}
+	return targets, nil
+}
+
+// Scan checks every target, stores the findings and returns them with the
+// events of what changed since the previous scan
+func (d *DB) Scan(tools Tools, toolchains Toolchains) ([]*Finding, []*Event, error) {
+	targets, err := Targets(tools, toolchains)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var findings []*Finding
+	for _, t := range targets {
+		f, err := d.Check(t)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+		findings = append(findings, f...)
+	}
+
+	var previous []*Event
+	if err = d.db.SelectContext(d.ctx, &previous, selectFindingsQuery); err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[string]*Event, len(previous))
+	for _, p := range previous {
+		seen[key(p.Kind, p.Target, p.Module, p.VulnID)] = p
+	}
+
+	var events []*Event
+	for _, f := range findings {
+		k := key(f.Kind, f.Target, f.Module, f.ID)
+		if _, ok := seen[k]; ok {
+			delete(seen, k)
+			continue
+		}
+		events = append(events, &Event{Event: EventFound, Kind: f.Kind, Target: f.Target, Module: f.Module, Version: f.Version, VulnID: f.ID, Fixed: f.Fixed})
+	}
+
+	for _, p := range previous {
+		if _, ok := seen[key(p.Kind, p.Target, p.Module, p.VulnID)]; ok {
+			p.Event = EventResolved
+			events = append(events, p)
+		}
+	}
+
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err = tx.ExecContext(d.ctx, deleteFindingsQuery); err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	for _, f := range findings {
+		if _, err = tx.ExecContext(d.ctx, insertFindingQuery, f.Kind, f.Target, f.Module, f.Version, f.ID, f.Fixed, strings.Join(f.Symbols, "\n")); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+	}
+
+	for _, e := range events {
+		if _, err = tx.ExecContext(d.ctx, insertEventQuery, e.Event, e.Kind, e.Target, e.Module, e.Version, e.VulnID, e.Fixed); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+	}
+	return findings, events, tx.Commit()
+}
+
+// Events returns the most recent events, newest first
+func (d *DB) Events(limit int) ([]*Event, error) {
+	var events []*Event
+	if err := d.db.SelectContext(d.ctx, &events, selectEventsQuery, limit); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// CronJob schedules an import of source whenever it changes and a scan of
+// the installed tools and toolchains, new and resolved findings are logged
+// as events
+func (d *DB) CronJob(spec, source string, tools Tools, toolchains Toolchains, cron *cron.Cron) error {
+	_, err := cron.AddFunc(spec, func() {
+		events, err := d.refresh(source, tools, toolchains)
+		if err != nil {
+			slog.Error(err.Error())
+		}
+
+		for _, e := range events {
+			if e.Event == EventFound {
+				slog.Warn("vulnerability found", "id", e.VulnID, "kind", e.Kind, "target", e.Target, "module", e.Module, "version", e.Version, "fixed", e.Fixed)
+			} else {
+				slog.Info("vulnerability resolved", "id", e.VulnID, "kind", e.Kind, "target", e.Target, "module", e.Module)
+			}
+		}
+	})
+	return err
+}
+
+// refresh imports source when it changed, then scans every target so tools
+// and toolchains installed since the last import are reported too
+func (d *DB) refresh(source string, tools Tools, toolchains Toolchains) ([]*Event, error) {
+	changed, err := d.changedSince(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		updated, err := d.Import(source)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("vulnerability database imported", "source", source, "updated", updated)
+	}
+
+	_, events, err := d.Scan(tools, toolchains)
+	return events, err
+}
+
+func key(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,530 @@
+package vuln
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/mod/semver"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Modules the Go vulnerability database uses for the toolchain itself
+const (
+	Stdlib    = "stdlib"
+	Toolchain = "toolchain"
+)
+
+const (
+	createTableEntry = `CREATE TABLE IF NOT EXISTS vuln_entry (
+    id TEXT PRIMARY KEY,
+    modified TIMESTAMP NOT NULL,
+    published TIMESTAMP NOT NULL,
+    aliases TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    details TEXT NOT NULL,
+    data TEXT NOT NULL
+)`
+
+	createTableAffected = `CREATE TABLE IF NOT EXISTS vuln_affected (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vuln_id TEXT NOT NULL,
+    module TEXT NOT NULL,
+    ranges TEXT NOT NULL,
+    imports TEXT NOT NULL,
+    FOREIGN KEY (vuln_id) REFERENCES vuln_entry(id)
+)`
+
+	createIndexAffected = `CREATE INDEX IF NOT EXISTS vuln_affected_module ON vuln_affected (module)`
+
+	createTableSource = `CREATE TABLE IF NOT EXISTS vuln_source (
+    path TEXT PRIMARY KEY,
+    mod_time TIMESTAMP NOT NULL,
+    entries INTEGER NOT NULL,
+    imported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+	selectEntryModifiedQuery = `SELECT modified FROM vuln_entry WHERE id = ?`
+	upsertEntryQuery         = `INSERT INTO vuln_entry (id, modified, published, aliases, summary, details, data) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT(id) DO UPDATE SET modified = excluded.modified, published = excluded.published, aliases = excluded.aliases, summary = excluded.summary, details = excluded.details, data = excluded.data`
+	deleteEntryQuery         = `DELETE FROM vuln_entry WHERE id = ?`
+	insertAffectedQuery      = `INSERT INTO vuln_affected (vuln_id, module, ranges, imports) VALUES (?, ?, ?, ?)`
+	deleteAffectedQuery      = `DELETE FROM vuln_affected WHERE vuln_id = ?`
+	selectAffectedQuery      = `SELECT a.vuln_id, a.ranges, a.imports, e.aliases, e.summary FROM vuln_affected a JOIN vuln_entry e ON e.id = a.vuln_id WHERE a.module = ? ORDER BY a.vuln_id`
+	selectSourceQuery        = `SELECT mod_time FROM vuln_source WHERE path = ?`
+	upsertSourceQuery        = `INSERT INTO vuln_source (path, mod_time, entries) VALUES (?, ?, ?) ON CONFLICT(path) DO UPDATE SET mod_time = excluded.mod_time, entries = excluded.entries, imported_at = CURRENT_TIMESTAMP`
+	countEntriesQuery        = `SELECT COUNT(*) FROM vuln_entry`
+)
+
+var ErrNoEntries = errors.New("no OSV entries found")
+
+// Entry is an OSV record of the Go vulnerability database
+type Entry struct {
+	ID        string     `json:"id"`
+	Modified  time.Time  `json:"modified"`
+	Published time.Time  `json:"published"`
+	Withdrawn *time.Time `json:"withdrawn,omitempty"`
+	Aliases   []string   `json:"aliases,omitempty"`
+	Summary   string     `json:"summary,omitempty"`
+	Details   string     `json:"details,omitempty"`
+	Affected  []Affected `json:"affected"`
+}
+
+// Affected is a module affected by an entry, with the vulnerable version
+// ranges and symbols
+type Affected struct {
+	Package           Package           `json:"package"`
+	Ranges            []Range           `json:"ranges,omitempty"`
+	EcosystemSpecific EcosystemSpecific `json:"ecosystem_specific"`
+}
+
+type Package struct {
+	Name      string `json:"name"`
+	Ecosystem string `json:"ecosystem"`
+}
+
+// Range is a list of introduced and fixed events, versions carry no v prefix
+type Range struct {
+	Type   string       `json:"type"`
+	Events []RangeEvent `json:"events"`
+}
+
+type RangeEvent struct {
+	Introduced string `json:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty"`
+}
+
+type EcosystemSpecific struct {
+	Imports []Import `json:"imports,omitempty"`
+}
+
+// Import is a vulnerable package and its vulnerable symbols
+type Import struct {
+	Path    string   `json:"path"`
+	GOOS    []string `json:"goos,omitempty"`
+	GOARCH  []string `json:"goarch,omitempty"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+// Module is a module version to check, stdlib and toolchain take Go versions
+// such as go1.22.5
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// Match is a vulnerability affecting a module version, Fixed is the version
+// fixing it, empty when there is none yet
+type Match struct {
+	ID      string   `json:"id"`
+	Aliases []string `json:"aliases,omitempty"`
+	Summary string   `json:"summary,omitempty"`
+	Module  string   `json:"module"`
+	Version string   `json:"version"`
+	Fixed   string   `json:"fixed,omitempty"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+// DB is a local copy of an OSV vulnerability database, it is filled by
+// Import and never goes to the network
+type DB struct {
+	db  *sqlx.DB
+	ctx context.Context
+}
+
+func NewDB(ctx context.Context, db *sqlx.DB) (*DB, error) {
+	d := &DB{
+		db:  db,
+		ctx: ctx,
+	}
+
+	for _, query := range []string{createTableEntry, createTableAffected, createIndexAffected, createTableSource, createTableFinding, createTableEvent} {
+		if _, err := d.db.ExecContext(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Import loads the OSV entries of a directory, such as a copy of
+// vuln.go.dev, or of a zip archive. Entries older than the stored ones are
+// skipped, withdrawn entries are removed. It returns the number of entries
+// added or updated
+func (d *DB) Import(path string) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []*Entry
+	if info.IsDir() {
+		entries, err = readDir(path)
+	} else {
+		entries, err = readZip(path)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if len(entries) == 0 {
+		return 0, fmt.Errorf("%s: %w", path, ErrNoEntries)
+	}
+
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, e := range entries {
+		changed, err := d.store(tx, e)
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("%s: %w", e.ID, err)
+		}
+
+		if changed {
+			updated++
+		}
+	}
+
+	modTime, err := sourceTime(path)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(d.ctx, upsertSourceQuery, path, modTime, len(entries)); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return updated, tx.Commit()
+}
+
+// Count returns the number of stored entries
+func (d *DB) Count() (int, error) {
+	var n int
+	err := d.db.GetContext(d.ctx, &n, countEntriesQuery)
+	return n, err
+}
+
+// Match returns the vulnerabilities affecting a module version
+func (d *DB) Match(m Module) ([]*Match, error) {
+	version := canonical(m)
+	if version == "" {
+		return nil, nil
+	}
+
+	var rows []struct {
+		ID      string `db:"vuln_id"`
+		Ranges  string `db:"ranges"`
+		Imports string `db:"imports"`
+		Aliases string `db:"aliases"`
+		Summary string `db:"summary"`
+	}
+	if err := d.db.SelectContext(d.ctx, &rows, selectAffectedQuery, m.Path); err != nil {
+		return nil, err
+	}
+
+	var matches []*Match
+	for _, row := range rows {
+		var ranges []Range
+		if err := json.Unmarshal([]byte(row.Ranges), &ranges); err != nil {
+			return nil, fmt.Errorf("%s: %w", row.ID, err)
+		}
+
+		affected, fixed := affects(ranges, version)
+		if !affected {
+			continue
+		}
+
+		match := &Match{ID: row.ID, Summary: row.Summary, Module: m.Path, Version: m.Version, Fixed: display(m.Path, fixed)}
+		if err := json.Unmarshal([]byte(row.Aliases), &match.Aliases); err != nil {
+			return nil, fmt.Errorf("%s: %w", row.ID, err)
+		}
+
+		var imports []Import
+		if err := json.Unmarshal([]byte(row.Imports), &imports); err != nil {
+			return nil, fmt.Errorf("%s: %w", row.ID, err)
+		}
+
+		for _, imp := range imports {
+			if len(imp.Symbols) == 0 {
+				match.Symbols = append(match.Symbols, imp.Path)
+			}
+
+			for _, s := range imp.Symbols {
+				match.Symbols = append(match.Symbols, imp.Path+"."+s)
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// changedSince reports whether a source was modified after its last import
+func (d *DB) changedSince(path string) (bool, error) {
+	modTime, err := sourceTime(path)
+	if err != nil {
+		return false, err
+	}
+
+	var imported time.Time
+	if err = d.db.GetContext(d.ctx, &imported, selectSourceQuery, path); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
+	}
+	return !modTime.Equal(imported.UTC()), nil
+}
+
+// sourceTime returns the modification time of a zip, or the newest one of
+// the files of a directory
+func sourceTime(path string) (time.Time, error) {
+	var newest time.Time
+	err := filepath.WalkDir(path, func(_ string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := de.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest.UTC(), err
+}
+
+// store writes an entry unless the stored copy is as recent, it reports
+// whether the database changed
+func (d *DB) store(tx *sqlx.Tx, e *Entry) (bool, error) {
+	var modified time.Time
+	err := tx.GetContext(d.ctx, &modified, selectEntryModifiedQuery, e.ID)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	if e.Withdrawn != nil {
+		if !exists {
+			return false, nil
+		}
+
+		if _, err = tx.ExecContext(d.ctx, deleteAffectedQuery, e.ID); err != nil {
+			return false, err
+		}
+		_, err = tx.ExecContext(d.ctx, deleteEntryQuery, e.ID)
+		return true, err
+	}
+
+	if exists && !e.Modified.After(modified) {
+		return false, nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return false, err
+	}
+
+	aliases, err := json.Marshal(nonNil(e.Aliases))
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = tx.ExecContext(d.ctx, upsertEntryQuery, e.ID, e.Modified.UTC(), e.Published.UTC(), string(aliases), e.Summary, e.Details, string(data)); err != nil {
+		return false, err
+	}
+
+	if _, err = tx.ExecContext(d.ctx, deleteAffectedQuery, e.ID); err != nil {
+		return false, err
+	}
+
+	for _, a := range e.Affected {
+		if a.Package.Ecosystem != "" && a.Package.Ecosystem != "Go" {
+			continue
+		}
+
+		ranges, err := json.Marshal(a.Ranges)
+		if err != nil {
+			return false, err
+		}
+
+		imports, err := json.Marshal(a.EcosystemSpecific.Imports)
+		if err != nil {
+			return false, err
+		}
+
+		if _, err = tx.ExecContext(d.ctx, insertAffectedQuery, e.ID, a.Package.Name, string(ranges), string(imports)); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// readDir reads every OSV entry below a directory, index files and other
+// JSON documents are skipped
+func readDir(root string) ([]*Entry, error) {
+	var entries []*Entry
+	err := filepath.WalkDir(root, func(path string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if e := decodeEntry(data); e != nil {
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// readZip reads every OSV entry of a zip archive
+func readZip(path string) ([]*Entry, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entries []*Entry
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !strings.HasSuffix(f.Name, ".json") {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		if e := decodeEntry(data); e != nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// decodeEntry returns the OSV entry of a JSON document, nil when it is not one
+func decodeEntry(data []byte) *Entry {
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil || e.ID == "" || len(e.Affected) == 0 {
+		return nil
+	}
+	return &e
+}
+
+// affects reports whether a version is inside one of the ranges and returns
+// the version fixing the range
+func affects(ranges []Range, version string) (bool, string) {
+	for _, r := range ranges {
+		if r.Type != "SEMVER" {
+			continue
+		}
+
+		introduced := ""
+		in := false
+		for _, ev := range r.Events {
+			switch {
+			case ev.Introduced != "":
+				introduced, in = ev.Introduced, true
+			case ev.Fixed != "" && in:
+				if after(version, introduced) && semver.Compare(version, "v"+ev.Fixed) < 0 {
+					return true, ev.Fixed
+				}
+				in = false
+			}
+		}
+
+		if in && after(version, introduced) {
+			return true, ""
+		}
+	}
+	return false, ""
+}
+
+func after(version, introduced string) bool {
+	return introduced == "0" || semver.Compare(version, "v"+introduced) >= 0
+}
+
+// canonical returns the semver of a module version, Go versions of the
+// stdlib and the toolchain are translated the way the database records them
+func canonical(m Module) string {
+	if m.Path != Stdlib && m.Path != Toolchain {
+		if !semver.IsValid(m.Version) {
+			return ""
+		}
+		return m.Version
+	}
+	return GoSemver(m.Version)
+}
+
+// GoSemver translates a Go version such as go1.21rc2 to v1.21.0-rc.2, empty
+// for development versions
+func GoSemver(v string) string {
+	v, pre := strings.TrimPrefix(v, "go"), ""
+	for _, p := range []string{"rc", "beta", "alpha"} {
+		if i := strings.Index(v, p); i > 0 {
+			v, pre = v[:i], "-"+p+"."+v[i+len(p):]
+			break
+		}
+	}
+
+	if strings.Count(v, ".") == 1 {
+		v += ".0"
+	}
+
+	if v = "v" + v + pre; !semver.IsValid(v) {
+		return ""
+	}
+	return v
+}
+
+// display returns a fixed version the way the module names its versions,
+// Go releases before 1.21 have no .0 patch
+func display(module, fixed string) string {
+	if fixed == "" {
+		return ""
+	}
+
+	if module != Stdlib && module != Toolchain {
+		return "v" + fixed
+	}
+
+	base, pre, _ := strings.Cut(fixed, "-")
+	if pre != "" || semver.Compare("v"+base, "v1.21.0") < 0 {
+		base = strings.TrimSuffix(base, ".0")
+	}
+	return "go" + base + strings.ReplaceAll(pre, ".", "")
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return slices.Clone(list)
+}
@@ -0,0 +1,278 @@
+package vuln
+
+import (
+	"archive/zip"
+	"context"
+	"github.com/inovacc/moonlight/internal/database"
+	"github.com/inovacc/moonlight/internal/database/databasetest"
+	"github.com/inovacc/moonlight/internal/installer"
+	"github.com/inovacc/moonlight/internal/toolchain"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	entryTool = `{
+  "id": "GO-2024-0001",
+  "modified": "2024-03-01T00:00:00Z",
+  "published": "2024-02-01T00:00:00Z",
+  "aliases": ["CVE-2024-0001"],
+  "summary": "Panic in example.com/lib",
+  "affected": [{
+    "package": {"name": "example.com/lib", "ecosystem": "Go"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.2.0"}, {"introduced": "1.3.0"}, {"fixed": "1.3.2"}]}],
+    "ecosystem_specific": {"imports": [{"path": "example.com/lib/parse", "symbols": ["Parse", "Reader.Next"]}]}
+  }]
+}`
+
+	entryStdlib = `{
+  "id": "GO-2024-0002",
+  "modified": "2024-03-01T00:00:00Z",
+  "published": "2024-02-01T00:00:00Z",
+  "summary": "Excessive memory in net/http",
+  "affected": [{
+    "package": {"name": "stdlib", "ecosystem": "Go"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.21.8"}, {"introduced": "1.22.0-0"}, {"fixed": "1.22.1"}]}],
+    "ecosystem_specific": {"imports": [{"path": "net/http"}]}
+  }]
+}`
+
+	entryWithdrawn = `{
+  "id": "GO-2024-0001",
+  "modified": "2024-04-01T00:00:00Z",
+  "published": "2024-02-01T00:00:00Z",
+  "withdrawn": "2024-04-01T00:00:00Z",
+  "affected": [{"package": {"name": "example.com/lib", "ecosystem": "Go"}}]
+}`
+)
+
+type fakeTools map[*installer.Install]*installer.BuildInfo
+
+func (f fakeTools) Installs() ([]*installer.Install, error) {
+	var list []*installer.Install
+	for in := range f {
+		list = append(list, in)
+	}
+	return list, nil
+}
+
+func (f fakeTools) BuildInfo(in *installer.Install) (*installer.BuildInfo, error) {
+	if b := f[in]; b != nil {
+		return b, nil
+	}
+	return nil, installer.ErrNoBuildInfo
+}
+
+type fakeToolchains []string
+
+func (f fakeToolchains) List() ([]*toolchain.Toolchain, error) {
+	var list []*toolchain.Toolchain
+	for _, v := range f {
+		list = append(list, &toolchain.Toolchain{Version: v})
+	}
+	return list, nil
+}
+
+func TestGoSemver(t *testing.T) {
+	for in, want := range map[string]string{
+		"go1.22.5":   "v1.22.5",
+		"go1.20":     "v1.20.0",
+		"go1.21rc2":  "v1.21.0-rc.2",
+		"go1.9beta1": "v1.9.0-beta.1",
+		"devel +abc": "",
+	} {
+		assert.Equal(t, want, GoSemver(in), in)
+	}
+
+	assert.Equal(t, "go1.21.8", display(Stdlib, "1.21.8"))
+	assert.Equal(t, "go1.20", display(Stdlib, "1.20.0"))
+	assert.Equal(t, "go1.22rc1", display(Stdlib, "1.22.0-rc.1"))
+	assert.Equal(t, "v1.2.0", display("example.com/lib", "1.2.0"))
+}
+
+func TestScan(t *testing.T) {
+	databasetest.Open(t)
+
+	db, err := NewDB(context.Background(), database.GetConnection())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := t.TempDir()
+	writeFile(t, source, "index/db.json", `{"modified":"2024-03-01T00:00:00Z"}`)
+	writeFile(t, source, "index/modules.json", `[{"path":"example.com/lib"}]`)
+	writeFile(t, source, "ID/GO-2024-0001.json", entryTool)
+	writeFile(t, source, "ID/GO-2024-0002.json", entryStdlib)
+
+	changed, err := db.changedSince(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, changed)
+
+	updated, err := db.Import(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, updated)
+
+	changed, err = db.changedSince(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, changed)
+
+	// importing the same entries again changes nothing
+	updated, err = db.Import(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, updated)
+
+	for version, fixed := range map[string]string{"v1.1.0": "v1.2.0", "v1.3.1": "v1.3.2", "v1.2.5": "", "v1.3.2": ""} {
+		matches, err := db.Match(Module{Path: "example.com/lib", Version: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fixed == "" {
+			assert.Empty(t, matches, version)
+			continue
+		}
+
+		if assert.Len(t, matches, 1, version) {
+			assert.Equal(t, fixed, matches[0].Fixed)
+			assert.Equal(t, []string{"CVE-2024-0001"}, matches[0].Aliases)
+			assert.Equal(t, []string{"example.com/lib/parse.Parse", "example.com/lib/parse.Reader.Next"}, matches[0].Symbols)
+		}
+	}
+
+	tools := fakeTools{
+		&installer.Install{ID: 1, Package: "example.com/tool/cmd/a", Version: "v1.0.0"}: {
+			Module:    "example.com/tool",
+			Version:   "v1.0.0",
+			GoVersion: "go1.22.0",
+			Deps:      []*installer.Dependency{{Path: "example.com/lib", Version: "v1.1.0"}},
+		},
+		&installer.Install{ID: 2, Package: "example.com/tool/cmd/b", Version: "v0.1.0"}: nil,
+	}
+
+	findings, events, err := db.Scan(tools, fakeToolchains{"go1.21.8", "go1.21.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.Target+" "+f.Module+" "+f.ID+" "+f.Fixed)
+	}
+	assert.ElementsMatch(t, []string{
+		"a@v1.0.0 example.com/lib GO-2024-0001 v1.2.0",
+		"a@v1.0.0 stdlib GO-2024-0002 go1.22.1",
+		"go1.21.7 stdlib GO-2024-0002 go1.21.8",
+	}, got)
+	assert.Len(t, events, 3)
+
+	// experiments after the Go version do not hide the stdlib
+	boring, err := db.Check(ToolTarget("boring@v1.0.0", &installer.BuildInfo{GoVersion: "go1.22.0 X:boringcrypto"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, boring, 1) {
+		assert.Equal(t, "go1.22.0", boring[0].Version)
+		assert.Equal(t, "go1.22.1", boring[0].Fixed)
+	}
+
+	// a rescan without changes raises nothing
+	_, events, err = db.Scan(tools, fakeToolchains{"go1.21.8", "go1.21.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, events)
+
+	// a zip export withdrawing an entry resolves its findings
+	archive := filepath.Join(t.TempDir(), "vulndb.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("ID/GO-2024-0001.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte(entryWithdrawn)); err != nil {
+		t.Fatal(err)
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if updated, err = db.Import(archive); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, updated)
+
+	_, events, err = db.Scan(tools, fakeToolchains{"go1.21.8", "go1.21.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, EventResolved, events[0].Event)
+		assert.Equal(t, "GO-2024-0001", events[0].VulnID)
+	}
+
+	recent, err := db.Events(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, recent, 4)
+	assert.Equal(t, EventResolved, recent[0].Event)
+
+	// a scheduled run reports a toolchain installed while the source is unchanged
+	if events, err = db.refresh(archive, tools, fakeToolchains{"go1.21.8", "go1.21.7"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, events)
+
+	if events, err = db.refresh(archive, tools, fakeToolchains{"go1.21.8", "go1.21.7", "go1.21.6"}); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, EventFound, events[0].Event)
+		assert.Equal(t, "go1.21.6", events[0].Target)
+	}
+
+	_, err = db.Import(t.TempDir())
+	assert.ErrorIs(t, err, ErrNoEntries)
+
+	// a changed file of the directory is noticed
+	later := time.Now().Add(time.Hour)
+	if err = os.Chtimes(filepath.Join(source, "ID/GO-2024-0002.json"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	changed, err = db.changedSince(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, changed)
+}
+
+func writeFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}